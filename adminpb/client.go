@@ -0,0 +1,94 @@
+package adminpb
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// AdminServiceClient is the client side of AdminService, used by
+// cmd/hmqctl and any other tooling that wants to talk to a running
+// broker.
+type AdminServiceClient interface {
+	ListClients(ctx context.Context, req *ListClientsRequest) (AdminService_ListClientsClient, error)
+	GetClient(ctx context.Context, req *GetClientRequest) (*GetClientResponse, error)
+	DisconnectClient(ctx context.Context, req *DisconnectClientRequest) (*DisconnectClientResponse, error)
+	PublishMessage(ctx context.Context, req *PublishMessageRequest) (*PublishMessageResponse, error)
+	ListSubscriptions(ctx context.Context, req *ListSubscriptionsRequest) (*ListSubscriptionsResponse, error)
+	Stats(ctx context.Context, req *StatsRequest) (*StatsResponse, error)
+}
+
+// AdminService_ListClientsClient is the client side of the ListClients
+// stream.
+type AdminService_ListClientsClient interface {
+	Recv() (*ClientInfo, error)
+	grpc.ClientStream
+}
+
+type adminServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewAdminServiceClient wraps cc (already dialed with
+// grpc.WithDefaultCallOptions(grpc.CallContentSubtype("json")), see
+// cmd/hmqctl) as an AdminServiceClient.
+func NewAdminServiceClient(cc *grpc.ClientConn) AdminServiceClient {
+	return &adminServiceClient{cc: cc}
+}
+
+func (c *adminServiceClient) ListClients(ctx context.Context, req *ListClientsRequest) (AdminService_ListClientsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ServiceDesc.Streams[0], "/adminpb.AdminService/ListClients")
+	if err != nil {
+		return nil, err
+	}
+	cs := &adminServiceListClientsClient{stream}
+	if err := cs.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err := cs.CloseSend(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+type adminServiceListClientsClient struct {
+	grpc.ClientStream
+}
+
+func (c *adminServiceListClientsClient) Recv() (*ClientInfo, error) {
+	m := new(ClientInfo)
+	if err := c.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adminServiceClient) GetClient(ctx context.Context, req *GetClientRequest) (*GetClientResponse, error) {
+	resp := new(GetClientResponse)
+	err := c.cc.Invoke(ctx, "/adminpb.AdminService/GetClient", req, resp)
+	return resp, err
+}
+
+func (c *adminServiceClient) DisconnectClient(ctx context.Context, req *DisconnectClientRequest) (*DisconnectClientResponse, error) {
+	resp := new(DisconnectClientResponse)
+	err := c.cc.Invoke(ctx, "/adminpb.AdminService/DisconnectClient", req, resp)
+	return resp, err
+}
+
+func (c *adminServiceClient) PublishMessage(ctx context.Context, req *PublishMessageRequest) (*PublishMessageResponse, error) {
+	resp := new(PublishMessageResponse)
+	err := c.cc.Invoke(ctx, "/adminpb.AdminService/PublishMessage", req, resp)
+	return resp, err
+}
+
+func (c *adminServiceClient) ListSubscriptions(ctx context.Context, req *ListSubscriptionsRequest) (*ListSubscriptionsResponse, error) {
+	resp := new(ListSubscriptionsResponse)
+	err := c.cc.Invoke(ctx, "/adminpb.AdminService/ListSubscriptions", req, resp)
+	return resp, err
+}
+
+func (c *adminServiceClient) Stats(ctx context.Context, req *StatsRequest) (*StatsResponse, error) {
+	resp := new(StatsResponse)
+	err := c.cc.Invoke(ctx, "/adminpb.AdminService/Stats", req, resp)
+	return resp, err
+}
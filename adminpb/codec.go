@@ -0,0 +1,29 @@
+package adminpb
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// jsonCodec lets AdminService run over a plain grpc.Server/ClientConn
+// without a protoc-generated protobuf codec: every message in this
+// package is a plain Go struct (de)serialized as JSON instead of wire
+// protobuf.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
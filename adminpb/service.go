@@ -0,0 +1,197 @@
+package adminpb
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AdminServiceServer is what Broker implements to back the gRPC admin
+// API. ListClients streams one ClientInfo per connected client.
+type AdminServiceServer interface {
+	ListClients(*ListClientsRequest, AdminService_ListClientsServer) error
+	GetClient(context.Context, *GetClientRequest) (*GetClientResponse, error)
+	DisconnectClient(context.Context, *DisconnectClientRequest) (*DisconnectClientResponse, error)
+	PublishMessage(context.Context, *PublishMessageRequest) (*PublishMessageResponse, error)
+	ListSubscriptions(context.Context, *ListSubscriptionsRequest) (*ListSubscriptionsResponse, error)
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+}
+
+// AdminService_ListClientsServer is the server side of the ListClients
+// stream.
+type AdminService_ListClientsServer interface {
+	Send(*ClientInfo) error
+	grpc.ServerStream
+}
+
+type adminServiceListClientsServer struct {
+	grpc.ServerStream
+}
+
+func (s *adminServiceListClientsServer) Send(m *ClientInfo) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+func handleListClients(srv interface{}, stream grpc.ServerStream) error {
+	req := new(ListClientsRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(AdminServiceServer).ListClients(req, &adminServiceListClientsServer{stream})
+}
+
+func handleGetClient(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(GetClientRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).GetClient(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/adminpb.AdminService/GetClient"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).GetClient(ctx, req.(*GetClientRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func handleDisconnectClient(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(DisconnectClientRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).DisconnectClient(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/adminpb.AdminService/DisconnectClient"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).DisconnectClient(ctx, req.(*DisconnectClientRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func handlePublishMessage(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(PublishMessageRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).PublishMessage(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/adminpb.AdminService/PublishMessage"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).PublishMessage(ctx, req.(*PublishMessageRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func handleListSubscriptions(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(ListSubscriptionsRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).ListSubscriptions(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/adminpb.AdminService/ListSubscriptions"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).ListSubscriptions(ctx, req.(*ListSubscriptionsRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func handleStats(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(StatsRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).Stats(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/adminpb.AdminService/Stats"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+// ServiceDesc is AdminService's grpc.ServiceDesc, registered on a
+// *grpc.Server with RegisterAdminServiceServer.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "adminpb.AdminService",
+	HandlerType: (*AdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetClient", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			return handleGetClient(srv, ctx, dec, interceptor)
+		}},
+		{MethodName: "DisconnectClient", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			return handleDisconnectClient(srv, ctx, dec, interceptor)
+		}},
+		{MethodName: "PublishMessage", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			return handlePublishMessage(srv, ctx, dec, interceptor)
+		}},
+		{MethodName: "ListSubscriptions", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			return handleListSubscriptions(srv, ctx, dec, interceptor)
+		}},
+		{MethodName: "Stats", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			return handleStats(srv, ctx, dec, interceptor)
+		}},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListClients",
+			Handler:       handleListClients,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "adminpb/admin.proto",
+}
+
+// RegisterAdminServiceServer registers srv as the AdminService
+// implementation on s.
+func RegisterAdminServiceServer(s *grpc.Server, srv AdminServiceServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
+
+// bearerAuthKey is the incoming metadata key carrying the bearer token,
+// e.g. set by a client via metadata.AppendToOutgoingContext(ctx,
+// "authorization", "Bearer <token>").
+const bearerAuthKey = "authorization"
+
+// UnaryAuthInterceptor rejects any call whose "authorization" metadata
+// isn't "Bearer <token>", letting AdminService's gRPC port be exposed on
+// an ops network without handing out unauthenticated broker control.
+func UnaryAuthInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkBearerToken(ctx, token); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor is UnaryAuthInterceptor's counterpart for the
+// ListClients stream.
+func StreamAuthInterceptor(token string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkBearerToken(ss.Context(), token); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkBearerToken(ctx context.Context, token string) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "adminpb: missing metadata")
+	}
+	values := md.Get(bearerAuthKey)
+	if len(values) == 0 || values[0] != "Bearer "+token {
+		return status.Error(codes.Unauthenticated, "adminpb: invalid or missing bearer token")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package adminpb defines the wire types and service contract for
+// AdminService, the gRPC API operators and tooling use to inspect and
+// manipulate a running broker without going through MQTT.
+//
+// There's no .proto/protoc step in this tree yet, so the "generated"
+// pieces here (types, service descriptor, client) are hand-written
+// instead, and messages are carried as JSON rather than a protobuf wire
+// format (see codec.go). Swapping this for real protoc-gen-go output
+// later shouldn't need to change AdminServiceServer or the call sites.
+package adminpb
+
+// ClientInfo describes one connected client.
+type ClientInfo struct {
+	ClientID    string `json:"clientId"`
+	RemoteAddr  string `json:"remoteAddr"`
+	PublishOnly bool   `json:"publishOnly"`
+}
+
+type ListClientsRequest struct{}
+
+type GetClientRequest struct {
+	ClientID string `json:"clientId"`
+}
+
+type GetClientResponse struct {
+	Client ClientInfo `json:"client"`
+	Found  bool       `json:"found"`
+}
+
+type DisconnectClientRequest struct {
+	ClientID string `json:"clientId"`
+}
+
+type DisconnectClientResponse struct {
+	Disconnected bool `json:"disconnected"`
+}
+
+type PublishMessageRequest struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+	Qos     byte   `json:"qos"`
+	Retain  bool   `json:"retain"`
+}
+
+type PublishMessageResponse struct{}
+
+type Subscription struct {
+	ClientID string `json:"clientId"`
+	Filter   string `json:"filter"`
+	Qos      byte   `json:"qos"`
+}
+
+type ListSubscriptionsRequest struct{}
+
+type ListSubscriptionsResponse struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+type StatsRequest struct{}
+
+type StatsResponse struct {
+	UptimeSeconds    int64 `json:"uptimeSeconds"`
+	ConnectedClients int64 `json:"connectedClients"`
+	MessagesIn       int64 `json:"messagesIn"`
+	MessagesOut      int64 `json:"messagesOut"`
+	WorkerPoolDepth  int64 `json:"workerPoolDepth"`
+}
@@ -0,0 +1,98 @@
+package broker
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/fhmq/hmq/adminpb"
+)
+
+// adminServer adapts Broker to adminpb.AdminServiceServer.
+type adminServer struct {
+	b *Broker
+}
+
+func (a *adminServer) ListClients(req *adminpb.ListClientsRequest, stream adminpb.AdminService_ListClientsServer) error {
+	var sendErr error
+	a.b.EachClient(func(c *client) error {
+		if sendErr != nil {
+			return nil
+		}
+		sendErr = stream.Send(clientInfo(c))
+		return sendErr
+	})
+	return sendErr
+}
+
+func (a *adminServer) GetClient(ctx context.Context, req *adminpb.GetClientRequest) (*adminpb.GetClientResponse, error) {
+	c, found := a.b.LoadClient(ClientIdentifier(req.ClientID))
+	if !found {
+		return &adminpb.GetClientResponse{Found: false}, nil
+	}
+	return &adminpb.GetClientResponse{Client: *clientInfo(c), Found: true}, nil
+}
+
+func (a *adminServer) DisconnectClient(ctx context.Context, req *adminpb.DisconnectClientRequest) (*adminpb.DisconnectClientResponse, error) {
+	c, found := a.b.LoadClient(ClientIdentifier(req.ClientID))
+	if !found {
+		return &adminpb.DisconnectClientResponse{Disconnected: false}, nil
+	}
+	c.Close()
+	return &adminpb.DisconnectClientResponse{Disconnected: true}, nil
+}
+
+func (a *adminServer) PublishMessage(ctx context.Context, req *adminpb.PublishMessageRequest) (*adminpb.PublishMessageResponse, error) {
+	packet := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	packet.TopicName = req.Topic
+	packet.Payload = req.Payload
+	packet.Qos = req.Qos
+	packet.Retain = req.Retain
+
+	// Inject the packet through the same path a client PUBLISH takes,
+	// using a synthetic client id so it isn't mistaken for a real
+	// subscriber when fanning out.
+	injected := &client{id: ClientIdentifier("$admin"), broker: a.b, ctx: ctx}
+	injected.ProcessPublish(ctx, packet)
+
+	return &adminpb.PublishMessageResponse{}, nil
+}
+
+func (a *adminServer) ListSubscriptions(ctx context.Context, req *adminpb.ListSubscriptionsRequest) (*adminpb.ListSubscriptionsResponse, error) {
+	all := a.b.topics.All()
+	subs := make([]adminpb.Subscription, 0, len(all))
+	for _, s := range all {
+		subs = append(subs, adminpb.Subscription{ClientID: s.ClientID, Filter: s.Filter, Qos: s.Qos})
+	}
+	return &adminpb.ListSubscriptionsResponse{Subscriptions: subs}, nil
+}
+
+func (a *adminServer) Stats(ctx context.Context, req *adminpb.StatsRequest) (*adminpb.StatsResponse, error) {
+	var connected int64
+	a.b.EachClient(func(c *client) error {
+		connected++
+		return nil
+	})
+
+	return &adminpb.StatsResponse{
+		UptimeSeconds:    int64(time.Since(a.b.startedAt).Seconds()),
+		ConnectedClients: connected,
+		MessagesIn:       atomic.LoadInt64(&a.b.messagesIn),
+		MessagesOut:      atomic.LoadInt64(&a.b.messagesOut),
+		// WorkerPoolDepth requires pool.WorkerPool to expose a queue
+		// depth accessor, which it doesn't yet; report 0 until it does.
+		WorkerPoolDepth: 0,
+	}, nil
+}
+
+func clientInfo(c *client) *adminpb.ClientInfo {
+	info := &adminpb.ClientInfo{
+		ClientID:    string(c.id),
+		PublishOnly: c.publishOnly,
+	}
+	if c.remoteAddr != nil {
+		info.RemoteAddr = c.remoteAddr.String()
+	}
+	return info
+}
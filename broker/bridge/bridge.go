@@ -0,0 +1,20 @@
+// Package bridge lets messages flowing through the broker be mirrored to
+// external systems (a message queue, a data lake ingest endpoint, ...).
+package bridge
+
+import "context"
+
+// Bridge is an outbound sink registered on the broker with AddBridge. It
+// is invoked for every PUBLISH after local fanout, from the broker's
+// worker pool, so a slow or stalled bridge can't block the client send
+// path.
+type Bridge interface {
+	// OnPublish mirrors a single published message. The broker calls it
+	// with context.Background(), so the broker itself never cancels ctx.
+	OnPublish(ctx context.Context, topic string, payload []byte, clientID string) error
+	// Start prepares the bridge (e.g. connects a producer) before any
+	// OnPublish call is made.
+	Start() error
+	// Stop flushes and releases anything Start acquired.
+	Stop() error
+}
@@ -0,0 +1,217 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// OverflowPolicy decides what happens when the KafkaBridge's bounded
+// buffer is full and a new message arrives.
+type OverflowPolicy string
+
+const (
+	// DropOldest discards the oldest buffered message to make room for
+	// the new one. This favors keeping up over completeness.
+	DropOldest OverflowPolicy = "drop-oldest"
+	// BlockProducer waits for room in the buffer, applying backpressure
+	// to OnPublish (and, transitively, to the broker's worker pool).
+	BlockProducer OverflowPolicy = "block"
+)
+
+// KafkaConfig configures a KafkaBridge.
+type KafkaConfig struct {
+	// Brokers is the Kafka bootstrap broker list.
+	Brokers []string `json:"brokers"`
+	// TopicTemplate maps an MQTT topic to a Kafka topic. "{clientID}" and
+	// "{topic}" are substituted; e.g. "mqtt.{topic}" or "mqtt.{clientID}".
+	TopicTemplate string `json:"topicTemplate"`
+	// Compression is one of "none", "gzip", "snappy", "lz4", "zstd".
+	// Defaults to "none".
+	Compression string `json:"compression"`
+	// Async selects sarama's AsyncProducer over its SyncProducer. Async
+	// mode trades delivery confirmation for throughput.
+	Async bool `json:"async"`
+	// BufferSize bounds the in-memory queue of messages waiting to be
+	// handed to the producer. Defaults to 1024.
+	BufferSize int `json:"bufferSize"`
+	// OverflowPolicy governs what happens once BufferSize is reached.
+	// Defaults to DropOldest.
+	OverflowPolicy OverflowPolicy `json:"overflowPolicy"`
+}
+
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"":       sarama.CompressionNone,
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+// KafkaBridge mirrors every PUBLISH to a Kafka topic derived from
+// TopicTemplate.
+type KafkaBridge struct {
+	config KafkaConfig
+	codec  sarama.CompressionCodec
+
+	mu       sync.Mutex
+	buffer   chan *sarama.ProducerMessage
+	async    sarama.AsyncProducer
+	sync     sarama.SyncProducer
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewKafkaBridge returns a KafkaBridge for config. It does not connect to
+// Kafka until Start is called.
+func NewKafkaBridge(config KafkaConfig) (*KafkaBridge, error) {
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("bridge: kafka brokers must not be empty")
+	}
+	if config.TopicTemplate == "" {
+		return nil, errors.New("bridge: kafka topicTemplate must not be empty")
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1024
+	}
+	if config.OverflowPolicy == "" {
+		config.OverflowPolicy = DropOldest
+	}
+	codec, ok := compressionCodecs[strings.ToLower(config.Compression)]
+	if !ok {
+		return nil, errors.New("bridge: unsupported kafka compression " + config.Compression)
+	}
+
+	return &KafkaBridge{
+		config: config,
+		codec:  codec,
+		buffer: make(chan *sarama.ProducerMessage, config.BufferSize),
+		stopCh: make(chan struct{}),
+	}, nil
+}
+
+func (k *KafkaBridge) Start() error {
+	conf := sarama.NewConfig()
+	conf.Producer.Compression = k.codec
+	conf.Producer.Return.Successes = true
+	conf.Producer.Return.Errors = true
+
+	if k.config.Async {
+		producer, err := sarama.NewAsyncProducer(k.config.Brokers, conf)
+		if err != nil {
+			return err
+		}
+		k.async = producer
+		k.wg.Add(1)
+		go k.drainAsyncResults()
+	} else {
+		producer, err := sarama.NewSyncProducer(k.config.Brokers, conf)
+		if err != nil {
+			return err
+		}
+		k.sync = producer
+	}
+
+	k.wg.Add(1)
+	go k.drainBuffer()
+
+	return nil
+}
+
+// drainAsyncResults discards successes and logs nothing for errors; the
+// broker's worker pool already logs OnPublish failures, and dropped Kafka
+// acks shouldn't be fatal to message delivery to MQTT subscribers.
+func (k *KafkaBridge) drainAsyncResults() {
+	defer k.wg.Done()
+	for {
+		select {
+		case <-k.async.Successes():
+		case <-k.async.Errors():
+		case <-k.stopCh:
+			return
+		}
+	}
+}
+
+func (k *KafkaBridge) drainBuffer() {
+	defer k.wg.Done()
+	for {
+		select {
+		case msg := <-k.buffer:
+			k.send(msg)
+		case <-k.stopCh:
+			return
+		}
+	}
+}
+
+func (k *KafkaBridge) send(msg *sarama.ProducerMessage) {
+	if k.async != nil {
+		k.async.Input() <- msg
+		return
+	}
+	// SyncProducer.SendMessage blocks until Kafka acks; errors are
+	// swallowed here for the same reason as the async result drain.
+	k.sync.SendMessage(msg)
+}
+
+func (k *KafkaBridge) OnPublish(ctx context.Context, topic string, payload []byte, clientID string) error {
+	kafkaTopic := strings.NewReplacer("{clientID}", clientID, "{topic}", topic).Replace(k.config.TopicTemplate)
+
+	msg := &sarama.ProducerMessage{
+		Topic: kafkaTopic,
+		Value: sarama.ByteEncoder(payload),
+	}
+
+	switch k.config.OverflowPolicy {
+	case BlockProducer:
+		select {
+		case k.buffer <- msg:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-k.stopCh:
+			return errors.New("bridge: kafka bridge stopped")
+		}
+	default: // DropOldest
+		select {
+		case k.buffer <- msg:
+			return nil
+		default:
+			select {
+			case <-k.buffer:
+			default:
+			}
+			select {
+			case k.buffer <- msg:
+			default:
+			}
+			return nil
+		}
+	}
+}
+
+// Stop ends the background goroutines and closes the producer, which
+// flushes messages already handed to it. Messages still waiting in the
+// in-memory buffer are discarded, not sent.
+func (k *KafkaBridge) Stop() error {
+	k.stopOnce.Do(func() {
+		close(k.stopCh)
+	})
+	k.wg.Wait()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.async != nil {
+		return k.async.Close()
+	}
+	if k.sync != nil {
+		return k.sync.Close()
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestNewKafkaBridgeValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config KafkaConfig
+	}{
+		{"no brokers", KafkaConfig{TopicTemplate: "mqtt.{topic}"}},
+		{"no topic template", KafkaConfig{Brokers: []string{"localhost:9092"}}},
+		{"bad compression", KafkaConfig{Brokers: []string{"localhost:9092"}, TopicTemplate: "mqtt.{topic}", Compression: "bogus"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewKafkaBridge(tt.config); err == nil {
+			t.Errorf("%s: NewKafkaBridge = nil error, want error", tt.name)
+		}
+	}
+}
+
+func TestNewKafkaBridgeDefaults(t *testing.T) {
+	kb, err := NewKafkaBridge(KafkaConfig{
+		Brokers:       []string{"localhost:9092"},
+		TopicTemplate: "mqtt.{topic}",
+	})
+	if err != nil {
+		t.Fatalf("NewKafkaBridge: %v", err)
+	}
+	if kb.config.BufferSize != 1024 {
+		t.Errorf("BufferSize = %d, want 1024", kb.config.BufferSize)
+	}
+	if kb.config.OverflowPolicy != DropOldest {
+		t.Errorf("OverflowPolicy = %q, want %q", kb.config.OverflowPolicy, DropOldest)
+	}
+	if kb.codec != sarama.CompressionNone {
+		t.Errorf("codec = %v, want CompressionNone", kb.codec)
+	}
+}
+
+func TestNewKafkaBridgeResolvesCompressionCodec(t *testing.T) {
+	kb, err := NewKafkaBridge(KafkaConfig{
+		Brokers:       []string{"localhost:9092"},
+		TopicTemplate: "mqtt.{topic}",
+		Compression:   "GZIP",
+	})
+	if err != nil {
+		t.Fatalf("NewKafkaBridge: %v", err)
+	}
+	if kb.codec != sarama.CompressionGZIP {
+		t.Errorf("codec = %v, want CompressionGZIP", kb.codec)
+	}
+}
+
+func TestOnPublishFillsTopicTemplate(t *testing.T) {
+	kb, err := NewKafkaBridge(KafkaConfig{
+		Brokers:       []string{"localhost:9092"},
+		TopicTemplate: "mqtt.{clientID}.{topic}",
+	})
+	if err != nil {
+		t.Fatalf("NewKafkaBridge: %v", err)
+	}
+
+	if err := kb.OnPublish(context.Background(), "a/b", []byte("payload"), "client1"); err != nil {
+		t.Fatalf("OnPublish: %v", err)
+	}
+
+	msg := <-kb.buffer
+	if msg.Topic != "mqtt.client1.a/b" {
+		t.Errorf("msg.Topic = %q, want mqtt.client1.a/b", msg.Topic)
+	}
+}
+
+func TestOnPublishDropOldestWhenFull(t *testing.T) {
+	kb, err := NewKafkaBridge(KafkaConfig{
+		Brokers:       []string{"localhost:9092"},
+		TopicTemplate: "{topic}",
+		BufferSize:    1,
+	})
+	if err != nil {
+		t.Fatalf("NewKafkaBridge: %v", err)
+	}
+
+	if err := kb.OnPublish(context.Background(), "first", nil, "c"); err != nil {
+		t.Fatalf("OnPublish(first): %v", err)
+	}
+	if err := kb.OnPublish(context.Background(), "second", nil, "c"); err != nil {
+		t.Fatalf("OnPublish(second): %v", err)
+	}
+
+	msg := <-kb.buffer
+	if msg.Topic != "second" {
+		t.Errorf("buffered message = %q, want the newest (second) to survive DropOldest", msg.Topic)
+	}
+}
+
+func TestOnPublishBlockProducerRespectsContextCancellation(t *testing.T) {
+	kb, err := NewKafkaBridge(KafkaConfig{
+		Brokers:        []string{"localhost:9092"},
+		TopicTemplate:  "{topic}",
+		BufferSize:     1,
+		OverflowPolicy: BlockProducer,
+	})
+	if err != nil {
+		t.Fatalf("NewKafkaBridge: %v", err)
+	}
+
+	if err := kb.OnPublish(context.Background(), "first", nil, "c"); err != nil {
+		t.Fatalf("OnPublish(first): %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := kb.OnPublish(ctx, "second", nil, "c"); err == nil {
+		t.Fatal("OnPublish with a full buffer and a cancelled context should error")
+	}
+}
@@ -1,14 +1,21 @@
 package broker
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"net"
 	"sync"
 	"time"
 
 	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/fhmq/hmq/adminpb"
+	"github.com/fhmq/hmq/broker/bridge"
+	"github.com/fhmq/hmq/broker/topics"
+	"github.com/fhmq/hmq/cluster"
 	"github.com/fhmq/hmq/pool"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
 type Message struct {
@@ -17,29 +24,132 @@ type Message struct {
 }
 
 type Broker struct {
-	id      string
-	mu      sync.Mutex
-	config  *Config
-	wpool   *pool.WorkerPool
-	clients sync.Map
+	id        string
+	mu        sync.Mutex
+	config    *Config
+	wpool     *pool.WorkerPool
+	clients   sync.Map
+	cluster   *cluster.Cluster
+	topics    *topics.Tree
+	retained  *topics.RetainedStore
+	bridges   []bridge.Bridge
+	startedAt time.Time
+
+	messagesIn  int64
+	messagesOut int64
+
+	grpcServer *grpc.Server
 }
 
 func NewBroker(config *Config) (*Broker, error) {
 	if config == nil {
 		config = DefaultConfig
 	}
+	if err := config.check(); err != nil {
+		return nil, err
+	}
 
 	b := &Broker{
-		id:     GenUniqueId(),
-		config: config,
-		wpool:  pool.New(config.Worker),
+		id:        GenUniqueId(),
+		config:    config,
+		wpool:     pool.New(config.Worker),
+		topics:    topics.New(),
+		retained:  topics.NewRetainedStore(),
+		startedAt: time.Now(),
+	}
+
+	if config.Cluster.Enabled {
+		if config.Cluster.NodeName == "" {
+			config.Cluster.NodeName = b.id
+		}
+
+		c, err := cluster.New(config.Cluster, b.handleForward)
+		if err != nil {
+			return nil, err
+		}
+		b.cluster = c
+	}
+
+	for _, bc := range config.Bridges {
+		switch bc.Type {
+		case "kafka":
+			if bc.Kafka == nil {
+				return nil, errors.New("bridge: kafka config missing for bridges entry")
+			}
+			kb, err := bridge.NewKafkaBridge(*bc.Kafka)
+			if err != nil {
+				return nil, err
+			}
+			b.AddBridge(kb)
+		default:
+			return nil, errors.New("bridge: unknown bridge type " + bc.Type)
+		}
 	}
 
 	return b, nil
 }
 
+// AddBridge registers bg to mirror every future PUBLISH. It does not start
+// bg; Broker.Start starts every registered bridge alongside the listener.
+func (b *Broker) AddBridge(bg bridge.Bridge) {
+	b.bridges = append(b.bridges, bg)
+}
+
+// forwardToBridges mirrors a PUBLISH to every registered bridge, each via
+// the worker pool so a slow bridge can't stall the client send path.
+func (b *Broker) forwardToBridges(topic string, payload []byte, clientID string) {
+	for _, bg := range b.bridges {
+		bg := bg
+		b.wpool.Submit(clientID+":bridge", func() {
+			if err := bg.OnPublish(context.Background(), topic, payload, clientID); err != nil {
+				log.Error("bridge OnPublish", zap.Error(err))
+			}
+		})
+	}
+}
+
+// handleForward delivers a PUBLISH forwarded by a peer node to this
+// node's local subscribers, the same way ProcessPublish delivers one
+// published locally: only clients whose subscription filter matches
+// env.Topic receive it, and a retained publish is retained here too, so
+// a client subscribing fresh after the fact still sees it regardless of
+// which node originally accepted the PUBLISH.
+func (b *Broker) handleForward(env cluster.Envelope) {
+	packet := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	packet.TopicName = env.Topic
+	packet.Payload = env.Payload
+	packet.Qos = env.Qos
+	packet.Retain = env.Retain
+
+	if env.Retain {
+		b.retained.Set(topics.RetainedMessage{
+			Topic:   env.Topic,
+			Payload: env.Payload,
+			Qos:     env.Qos,
+		})
+	}
+
+	for _, sub := range b.topics.Match(env.Topic) {
+		if sub.ClientID == env.OriginClientID {
+			continue
+		}
+		other, found := b.LoadClient(ClientIdentifier(sub.ClientID))
+		if !found || other.publishOnly {
+			continue
+		}
+		if err := other.Send(other.ctx, packet); err != nil {
+			log.Error("forward publish", zap.Error(err), zap.Any("ClientID", other.id))
+		}
+	}
+}
+
 func (b *Broker) AddClient(c *client) {
 	b.clients.Store(c.id, c)
+	if b.cluster != nil {
+		if err := b.cluster.AddClient(string(c.id)); err != nil {
+			log.Error("cluster add client", zap.Error(err), zap.Any("ClientID", c.id))
+		}
+	}
 }
 
 func (b *Broker) LoadClient(id ClientIdentifier) (*client, bool) {
@@ -50,8 +160,28 @@ func (b *Broker) LoadClient(id ClientIdentifier) (*client, bool) {
 	return nil, false
 }
 
+// ownedRemotely reports whether id is currently held by a peer node
+// rather than a local client, i.e. whether it's known to the replicated
+// cluster table but not to this node's own clients map.
+func (b *Broker) ownedRemotely(id ClientIdentifier) bool {
+	if b.cluster == nil {
+		return false
+	}
+	if _, local := b.LoadClient(id); local {
+		return false
+	}
+	_, found := b.cluster.Owner(string(id))
+	return found
+}
+
 func (b *Broker) DeleteClient(c *client) {
 	b.clients.Delete(c.id)
+	b.topics.UnsubscribeAll(string(c.id))
+	if b.cluster != nil {
+		if err := b.cluster.DeleteClient(string(c.id)); err != nil {
+			log.Error("cluster delete client", zap.Error(err), zap.Any("ClientID", c.id))
+		}
+	}
 }
 
 func (b *Broker) EachClient(fn func(client *client) error) {
@@ -67,8 +197,17 @@ func (b *Broker) EachClient(fn func(client *client) error) {
 }
 
 func (b *Broker) SubmitWork(msg *Message) {
+	// Tie queued work to the client's own lifetime: if it disconnects
+	// before the pool gets to this message, drop the message instead of
+	// processing it for a client that's already gone.
+	ctx := msg.client.ctx
 	b.wpool.Submit(string(msg.client.id), func() {
-		ProcessMessage(msg)
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		ProcessMessage(ctx, msg)
 	})
 }
 
@@ -78,10 +217,48 @@ func (b *Broker) Start() {
 		return
 	}
 
+	for _, bg := range b.bridges {
+		if err := bg.Start(); err != nil {
+			log.Error("start bridge", zap.Error(err))
+		}
+	}
+
 	//listen client over tcp
 	if b.config.Port != "" {
 		go b.StartClientListening()
 	}
+
+	if b.config.GrpcPort != "" {
+		go b.startAdminServer()
+	}
+}
+
+// startAdminServer runs the AdminService gRPC API alongside the MQTT
+// listener so operators and tooling can inspect/manipulate this broker
+// without going through MQTT.
+func (b *Broker) startAdminServer() {
+	hp := b.config.GrpcHost + ":" + b.config.GrpcPort
+	l, err := net.Listen("tcp", hp)
+	if err != nil {
+		log.Error("Error listening for admin gRPC", zap.Error(err))
+		return
+	}
+	log.Info("Start listening admin gRPC on ", zap.String("hp", hp))
+
+	var opts []grpc.ServerOption
+	if b.config.GrpcAuthToken != "" {
+		opts = append(opts,
+			grpc.UnaryInterceptor(adminpb.UnaryAuthInterceptor(b.config.GrpcAuthToken)),
+			grpc.StreamInterceptor(adminpb.StreamAuthInterceptor(b.config.GrpcAuthToken)),
+		)
+	}
+
+	b.grpcServer = grpc.NewServer(opts...)
+	adminpb.RegisterAdminServiceServer(b.grpcServer, &adminServer{b: b})
+
+	if err := b.grpcServer.Serve(l); err != nil {
+		log.Error("admin gRPC server stopped", zap.Error(err))
+	}
 }
 
 func (b *Broker) StartClientListening() {
@@ -177,7 +354,8 @@ func (b *Broker) handleConnackPacket(conn net.Conn, connect *packets.ConnectPack
 	//	return errors.New("connect not accepted")
 	//}
 
-	if _, found := b.LoadClient(ClientIdentifier(connect.ClientIdentifier)); found {
+	_, foundLocally := b.LoadClient(ClientIdentifier(connect.ClientIdentifier))
+	if foundLocally || b.ownedRemotely(ClientIdentifier(connect.ClientIdentifier)) {
 		connack.ReturnCode = packets.ErrRefusedNotAuthorised
 		if err := connack.Write(conn); err != nil {
 			return err
@@ -193,6 +371,13 @@ func (b *Broker) handleConnackPacket(conn net.Conn, connect *packets.ConnectPack
 }
 
 func (b *Broker) handleConnection(conn net.Conn) {
+	conn, remoteAddr, err := b.resolveProxyProtocol(conn)
+	if err != nil {
+		log.Error("proxy protocol", zap.Error(err))
+		conn.Close()
+		return
+	}
+
 	// process connect packet
 	connect, err := b.handleConnectPacket(conn)
 	if err != nil {
@@ -207,9 +392,68 @@ func (b *Broker) handleConnection(conn net.Conn) {
 	}
 
 	c := newClient(conn, b, connect.ClientIdentifier)
+	c.remoteAddr = remoteAddr
 
 	// save client ids
 	b.AddClient(c)
 
 	c.loop()
 }
+
+// resolveProxyProtocol reads an optional PROXY protocol header off conn
+// according to b.config.ProxyProtocol/TrustedProxies, returning the
+// connection the rest of the pipeline should read from (wrapped so no
+// bytes peeked while looking for the header are lost) along with the
+// address of the real client.
+func (b *Broker) resolveProxyProtocol(conn net.Conn) (net.Conn, net.Addr, error) {
+	peerAddr := conn.RemoteAddr()
+
+	mode := b.config.ProxyProtocol
+	if mode == "" || mode == ProxyProtocolOff {
+		return conn, peerAddr, nil
+	}
+
+	if !isTrustedProxy(peerAddr, b.config.TrustedProxies) {
+		if mode == ProxyProtocolRequired {
+			return conn, peerAddr, errors.New("proxyproto: peer not in TrustedProxies")
+		}
+		return conn, peerAddr, nil
+	}
+
+	br := bufio.NewReader(conn)
+	addr, err := readProxyHeader(br)
+	wrapped := &bufferedConn{Conn: conn, r: br}
+
+	if err != nil {
+		if err != errNoProxyHeader {
+			// A PROXY header started but was malformed (e.g. "PROXY
+			// UNKNOWN\r\n"): its bytes are already consumed off br, so
+			// falling back here would feed them into the MQTT CONNECT
+			// parser as if they were client data. Always treat this as
+			// fatal, even in optional mode.
+			return conn, peerAddr, err
+		}
+		if mode == ProxyProtocolRequired {
+			return conn, peerAddr, err
+		}
+		// optional, no header present: readProxyHeader only Peek'd, so
+		// no bytes were consumed (a v2 LOCAL header is consumed whole),
+		// and it's safe to fall back to the TCP peer address while still
+		// reading from br.
+		return wrapped, peerAddr, nil
+	}
+
+	return wrapped, addr, nil
+}
+
+// bufferedConn is a net.Conn whose Read is served from a bufio.Reader
+// that already peeked/consumed a PROXY protocol header, so bytes read
+// while detecting the header aren't lost to the rest of the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
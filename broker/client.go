@@ -4,9 +4,13 @@ import (
 	"context"
 	"errors"
 	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/fhmq/hmq/broker/topics"
+	"github.com/fhmq/hmq/cluster"
 	"go.uber.org/zap"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -32,6 +36,11 @@ type client struct {
 	status     int
 	ctx        context.Context
 	cancelFunc context.CancelFunc
+
+	// remoteAddr is the real client address. It's the TCP peer address,
+	// unless a trusted PROXY protocol header resolved it to the original
+	// client behind a load balancer or reverse proxy.
+	remoteAddr net.Addr
 }
 
 var (
@@ -50,15 +59,22 @@ func newClient(conn net.Conn, b *Broker, id string) *client {
 		status:     Connected,
 		ctx:        ctx,
 		cancelFunc: cancel,
+		remoteAddr: conn.RemoteAddr(),
 	}
 }
 
 func (c *client) loop() {
+	readTimeout := c.broker.config.ReadTimeout
+
 	for {
 		select {
 		case <-c.ctx.Done():
 			return
 		default:
+			if readTimeout > 0 {
+				c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+			}
+
 			packet, err := packets.ReadPacket(c.conn)
 			if err != nil {
 				log.Error("read packet error: ", zap.Error(err), zap.Any("ClientID", c.id))
@@ -79,7 +95,7 @@ func (c *client) loop() {
 	}
 }
 
-func ProcessMessage(msg *Message) {
+func ProcessMessage(ctx context.Context, msg *Message) {
 	c := msg.client
 	ca := msg.packet
 	if ca == nil {
@@ -90,18 +106,19 @@ func ProcessMessage(msg *Message) {
 	case *packets.ConnackPacket:
 	case *packets.ConnectPacket:
 	case *packets.PublishPacket:
-		c.ProcessPublish(packet)
+		c.ProcessPublish(ctx, packet)
 	case *packets.PubackPacket:
 	case *packets.PubrecPacket:
 	case *packets.PubrelPacket:
 	case *packets.PubcompPacket:
 	case *packets.SubscribePacket:
-		c.ProcessSubscribe(packet)
+		c.ProcessSubscribe(ctx, packet)
 	case *packets.SubackPacket:
 	case *packets.UnsubscribePacket:
+		c.ProcessUnsubscribe(ctx, packet)
 	case *packets.UnsubackPacket:
 	case *packets.PingreqPacket:
-		c.ProcessPing()
+		c.ProcessPing(ctx)
 	case *packets.PingrespPacket:
 	case *packets.DisconnectPacket:
 		c.Close()
@@ -110,20 +127,51 @@ func ProcessMessage(msg *Message) {
 	}
 }
 
-func (c *client) ProcessPublish(packet *packets.PublishPacket) {
-	c.broker.EachClient(func(other *client) error {
-		if c.id == other.id || other.publishOnly {
-			// skip
-			return nil
+func (c *client) ProcessPublish(ctx context.Context, packet *packets.PublishPacket) {
+	b := c.broker
+	atomic.AddInt64(&b.messagesIn, 1)
+
+	if packet.Retain {
+		b.retained.Set(topics.RetainedMessage{
+			Topic:   packet.TopicName,
+			Payload: packet.Payload,
+			Qos:     packet.Qos,
+		})
+	}
+
+	for _, sub := range b.topics.Match(packet.TopicName) {
+		if sub.ClientID == string(c.id) {
+			continue
+		}
+		other, found := b.LoadClient(ClientIdentifier(sub.ClientID))
+		if !found || other.publishOnly {
+			continue
 		}
 
 		// TODO: do something before send
 
-		return other.Send(packet)
-	})
+		if err := other.Send(ctx, packet); err != nil {
+			log.Error("forward publish", zap.Error(err), zap.Any("ClientID", other.id))
+		}
+	}
+
+	if b.cluster != nil {
+		env := cluster.Envelope{
+			OriginClientID: string(c.id),
+			Topic:          packet.TopicName,
+			Payload:        packet.Payload,
+			Qos:            packet.Qos,
+			Retain:         packet.Retain,
+		}
+		if err := b.cluster.Forward(env); err != nil {
+			log.Error("cluster forward publish", zap.Error(err), zap.Any("ClientID", c.id))
+		}
+	}
+
+	b.forwardToBridges(packet.TopicName, packet.Payload, string(c.id))
 }
 
-func (c *client) ProcessSubscribe(packet *packets.SubscribePacket) {
+func (c *client) ProcessSubscribe(ctx context.Context, packet *packets.SubscribePacket) {
 	if c.status == Disconnected {
 		return
 	}
@@ -132,31 +180,81 @@ func (c *client) ProcessSubscribe(packet *packets.SubscribePacket) {
 	if b == nil {
 		return
 	}
-	topics := packet.Topics
+	filters := packet.Topics
 
 	suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
 	suback.MessageID = packet.MessageID
 	var retcodes []byte
 
-	for range topics {
-		// QoS=0 only
-		retcodes = append(retcodes, 0)
+	for i, filter := range filters {
+		requested := byte(0)
+		if i < len(packet.Qoss) {
+			requested = packet.Qoss[i]
+		}
+
+		granted := b.topics.Subscribe(string(c.id), filter, requested)
+		retcodes = append(retcodes, granted)
+
+		if b.cluster != nil {
+			if err := b.cluster.Subscribe(string(c.id), filter); err != nil {
+				log.Error("cluster subscribe", zap.Error(err), zap.Any("ClientID", c.id))
+			}
+		}
 	}
 
 	suback.ReturnCodes = retcodes
 
-	err := c.Send(suback)
+	err := c.Send(ctx, suback)
 	if err != nil {
 		log.Error("send suback error, ", zap.Error(err), zap.Any("ClientID", c.id))
 		return
 	}
+
+	for _, filter := range filters {
+		for _, retained := range b.retained.Match(filter) {
+			pub := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+			pub.TopicName = retained.Topic
+			pub.Payload = retained.Payload
+			pub.Qos = retained.Qos
+			pub.Retain = true
+			if err := c.Send(ctx, pub); err != nil {
+				log.Error("send retained message error, ", zap.Error(err), zap.Any("ClientID", c.id))
+			}
+		}
+	}
+}
+
+func (c *client) ProcessUnsubscribe(ctx context.Context, packet *packets.UnsubscribePacket) {
+	if c.status == Disconnected {
+		return
+	}
+
+	b := c.broker
+	if b == nil {
+		return
+	}
+
+	for _, filter := range packet.Topics {
+		b.topics.Unsubscribe(string(c.id), filter)
+		if b.cluster != nil {
+			if err := b.cluster.Unsubscribe(string(c.id), filter); err != nil {
+				log.Error("cluster unsubscribe", zap.Error(err), zap.Any("ClientID", c.id))
+			}
+		}
+	}
+
+	unsuback := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+	unsuback.MessageID = packet.MessageID
+	if err := c.Send(ctx, unsuback); err != nil {
+		log.Error("send unsuback error, ", zap.Error(err), zap.Any("ClientID", c.id))
+	}
 }
 
-func (c *client) ProcessPing() {
+func (c *client) ProcessPing(ctx context.Context) {
 	if c.status == Disconnected {
 		return
 	}
-	err := c.Send(PingrespPacket)
+	err := c.Send(ctx, PingrespPacket)
 	if err != nil {
 		log.Error("send PingResponse error, ", zap.Error(err), zap.Any("ClientID", c.id))
 		return
@@ -187,7 +285,7 @@ func (c *client) Close() {
 	}
 }
 
-func (c *client) Send(packet packets.ControlPacket) error {
+func (c *client) Send(ctx context.Context, packet packets.ControlPacket) error {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Error("recover error, ", zap.Any("recover", err))
@@ -205,8 +303,21 @@ func (c *client) Send(packet packets.ControlPacket) error {
 		return errors.New("connection lost")
 	}
 
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(c.broker.config.WriteTimeout)
+	}
+
 	c.mu.Lock()
-	err := packet.Write(c.conn)
-	c.mu.Unlock()
-	return err
+	defer c.mu.Unlock()
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	if err := packet.Write(c.conn); err != nil {
+		return err
+	}
+	if c.broker != nil {
+		atomic.AddInt64(&c.broker.messagesOut, 1)
+	}
+	return nil
 }
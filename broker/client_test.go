@@ -0,0 +1,166 @@
+package broker
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/fhmq/hmq/broker/topics"
+	"github.com/fhmq/hmq/pool"
+)
+
+// deadlineConn wraps a net.Conn, recording every SetWriteDeadline/
+// SetReadDeadline call so tests can assert on the deadlines Send and
+// client.loop set without racing a real timeout.
+type deadlineConn struct {
+	net.Conn
+	writeDeadlines []time.Time
+	readDeadlines  []time.Time
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadlines = append(c.writeDeadlines, t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.readDeadlines = append(c.readDeadlines, t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+func TestSendUsesContextDeadline(t *testing.T) {
+	server, clientConn := net.Pipe()
+	defer server.Close()
+	defer clientConn.Close()
+
+	dc := &deadlineConn{Conn: clientConn}
+	c := newClient(dc, &Broker{config: &Config{WriteTimeout: time.Minute}}, "c1")
+
+	go func() {
+		buf := make([]byte, 64)
+		server.Read(buf)
+	}()
+
+	want := time.Now().Add(5 * time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), want)
+	defer cancel()
+
+	if err := c.Send(ctx, PingrespPacket); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if len(dc.writeDeadlines) != 1 || !dc.writeDeadlines[0].Equal(want) {
+		t.Fatalf("write deadline = %v, want %v", dc.writeDeadlines, want)
+	}
+}
+
+func TestSendFallsBackToConfigWriteTimeout(t *testing.T) {
+	server, clientConn := net.Pipe()
+	defer server.Close()
+	defer clientConn.Close()
+
+	dc := &deadlineConn{Conn: clientConn}
+	c := newClient(dc, &Broker{config: &Config{WriteTimeout: 3 * time.Second}}, "c1")
+
+	go func() {
+		buf := make([]byte, 64)
+		server.Read(buf)
+	}()
+
+	before := time.Now()
+	if err := c.Send(context.Background(), PingrespPacket); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if len(dc.writeDeadlines) != 1 {
+		t.Fatalf("want 1 write deadline, got %d", len(dc.writeDeadlines))
+	}
+	got := dc.writeDeadlines[0]
+	if got.Before(before.Add(3*time.Second)) || got.After(time.Now().Add(3*time.Second)) {
+		t.Fatalf("write deadline = %v, want ~%v (ctx carried no deadline of its own)", got, before.Add(3*time.Second))
+	}
+}
+
+func TestSubmitWorkDropsQueuedWorkAfterCancel(t *testing.T) {
+	_, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	b := &Broker{
+		wpool:    pool.New(1),
+		topics:   topics.New(),
+		retained: topics.NewRetainedStore(),
+	}
+	c := newClient(clientConn, b, "c1")
+	c.cancelFunc()
+
+	pub := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	pub.TopicName = "a/b"
+	pub.Payload = []byte("hi")
+
+	b.SubmitWork(&Message{client: c, packet: pub})
+
+	// The pool has a single worker, so once this later task runs the
+	// SubmitWork task above has already run (or been dropped).
+	done := make(chan struct{})
+	b.wpool.Submit(string(c.id), func() { close(done) })
+	<-done
+
+	if n := atomic.LoadInt64(&b.messagesIn); n != 0 {
+		t.Fatalf("messagesIn = %d, want 0: SubmitWork should drop work queued for a client whose ctx is already cancelled", n)
+	}
+}
+
+func TestLoopResetsReadDeadline(t *testing.T) {
+	server, clientConn := net.Pipe()
+	dc := &deadlineConn{Conn: clientConn}
+
+	b := &Broker{
+		config:   &Config{ReadTimeout: 50 * time.Millisecond, WriteTimeout: time.Second},
+		wpool:    pool.New(1),
+		topics:   topics.New(),
+		retained: topics.NewRetainedStore(),
+	}
+	c := newClient(dc, b, "c1")
+
+	done := make(chan struct{})
+	go func() {
+		c.loop()
+		close(done)
+	}()
+
+	// Drain whatever client.loop writes back (a PINGRESP per PINGREQ), so
+	// Send doesn't block writing into the unbuffered pipe.
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := packets.NewControlPacket(packets.Pingreq).(*packets.PingreqPacket)
+	if err := ping.Write(server); err != nil {
+		t.Fatalf("write ping 1: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := ping.Write(server); err != nil {
+		t.Fatalf("write ping 2: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	server.Close()
+	<-done
+
+	if len(dc.readDeadlines) < 3 {
+		t.Fatalf("want at least 3 read deadlines (one per loop iteration), got %d", len(dc.readDeadlines))
+	}
+	for i := 1; i < len(dc.readDeadlines); i++ {
+		if !dc.readDeadlines[i].After(dc.readDeadlines[i-1]) {
+			t.Fatalf("read deadline %d (%v) did not advance past deadline %d (%v); ReadTimeout should reset every iteration", i, dc.readDeadlines[i], i-1, dc.readDeadlines[i-1])
+		}
+	}
+}
@@ -6,15 +6,57 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
+	"github.com/fhmq/hmq/broker/bridge"
+	"github.com/fhmq/hmq/cluster"
 	"github.com/fhmq/hmq/logger"
 )
 
+// BridgeConfig is one entry of Config.Bridges. Type selects which
+// implementation Kafka (and any sink added later) configures; today
+// "kafka" is the only supported value.
+type BridgeConfig struct {
+	Type  string              `json:"type"`
+	Kafka *bridge.KafkaConfig `json:"kafka,omitempty"`
+}
+
 type Config struct {
-	Worker int    `json:"workerNum"`
-	Host   string `json:"host"`
-	Port   string `json:"port"`
-	Debug  bool   `json:"debug"`
+	Worker  int            `json:"workerNum"`
+	Host    string         `json:"host"`
+	Port    string         `json:"port"`
+	Debug   bool           `json:"debug"`
+	Cluster cluster.Config `json:"cluster"`
+
+	// ProxyProtocol controls whether StartClientListening expects a PROXY
+	// protocol v1/v2 header in front of each connection, e.g. when hmq
+	// sits behind an L4 load balancer or TLS-terminating reverse proxy.
+	ProxyProtocol ProxyProtocolMode `json:"proxyProtocol"`
+	// TrustedProxies is the CIDR allowlist of peers allowed to send a
+	// PROXY header. Connections from peers outside this list never have
+	// their header parsed, regardless of ProxyProtocol.
+	TrustedProxies []string `json:"trustedProxies"`
+
+	// Bridges mirrors published messages to external systems; see
+	// broker/bridge.
+	Bridges []BridgeConfig `json:"bridges"`
+
+	// WriteTimeout bounds how long client.Send waits for a packet write
+	// to complete when the context passed to it carries no deadline of
+	// its own.
+	WriteTimeout time.Duration `json:"writeTimeout"`
+	// ReadTimeout, when non-zero, is applied as a read deadline before
+	// every packet read in client.loop, reset after each successful read,
+	// so a half-open TCP connection gets reaped instead of leaking.
+	ReadTimeout time.Duration `json:"readTimeout"`
+
+	// GrpcHost/GrpcPort start the AdminService gRPC API alongside the
+	// MQTT listener when GrpcPort is non-empty.
+	GrpcHost string `json:"grpcHost"`
+	GrpcPort string `json:"grpcPort"`
+	// GrpcAuthToken, when set, is required as a "Bearer <token>"
+	// "authorization" metadata value on every AdminService call.
+	GrpcAuthToken string `json:"grpcAuthToken"`
 }
 
 type NamedPlugins struct {
@@ -22,9 +64,11 @@ type NamedPlugins struct {
 }
 
 var DefaultConfig *Config = &Config{
-	Worker: 4096,
-	Host:   "0.0.0.0",
-	Port:   "1883",
+	Worker:        4096,
+	Host:          "0.0.0.0",
+	Port:          "1883",
+	ProxyProtocol: ProxyProtocolOff,
+	WriteTimeout:  10 * time.Second,
 }
 
 var (
@@ -127,5 +171,13 @@ func (config *Config) check() error {
 		}
 	}
 
+	if config.ProxyProtocol == "" {
+		config.ProxyProtocol = ProxyProtocolOff
+	}
+
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = DefaultConfig.WriteTimeout
+	}
+
 	return nil
 }
@@ -0,0 +1,176 @@
+package broker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ProxyProtocolMode controls whether StartClientListening expects a PROXY
+// protocol header (v1 text or v2 binary, per the HAProxy spec) in front of
+// every connection.
+type ProxyProtocolMode string
+
+const (
+	// ProxyProtocolOff never attempts to read a PROXY header; the TCP
+	// peer address is used as-is. This is the default.
+	ProxyProtocolOff ProxyProtocolMode = "off"
+	// ProxyProtocolOptional reads a PROXY header when the peer is in
+	// TrustedProxies, and falls back to the TCP peer address otherwise.
+	ProxyProtocolOptional ProxyProtocolMode = "optional"
+	// ProxyProtocolRequired rejects connections from a trusted proxy that
+	// don't start with a valid PROXY header.
+	ProxyProtocolRequired ProxyProtocolMode = "required"
+)
+
+var proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// isTrustedProxy reports whether addr's IP falls inside one of the
+// configured TrustedProxies CIDRs.
+func isTrustedProxy(addr net.Addr, trusted []string) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range trusted {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// readProxyHeader reads and validates a PROXY protocol v1 or v2 header
+// from r, returning the source address it carries. It returns
+// errNoProxyHeader when the stream doesn't start with either signature
+// (nothing is consumed then), or when a v2 header carries the LOCAL
+// command (that header is consumed), so callers in "optional" mode can
+// fall back to the TCP peer address.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	peek, err := r.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(peek, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+
+	peek, err = r.Peek(5)
+	if err == nil && string(peek) == "PROXY" {
+		return readProxyV1(r)
+	}
+
+	return nil, errNoProxyHeader
+}
+
+var errNoProxyHeader = errors.New("proxyproto: no PROXY header present")
+
+// readProxyV1 parses the text framing:
+// "PROXY TCP4 1.2.3.4 5.6.7.8 443 8080\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, errors.New("proxyproto: malformed v1 header")
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, errors.New("proxyproto: UNKNOWN v1 source")
+	}
+	if len(fields) != 6 {
+		return nil, errors.New("proxyproto: malformed v1 header")
+	}
+
+	srcIP := net.ParseIP(fields[2])
+	if srcIP == nil {
+		return nil, errors.New("proxyproto: invalid v1 source address")
+	}
+	srcPort, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, errors.New("proxyproto: invalid v1 source port")
+	}
+
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, nil
+}
+
+// readProxyV2 parses the binary framing defined by section 2.2 of the
+// PROXY protocol spec: a 12-byte signature, a version/command byte, a
+// family/protocol byte, a 2-byte big-endian length, then that many bytes
+// of address payload.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := readFull(r, header); err != nil {
+		return nil, err
+	}
+
+	verCmd := header[12]
+	if verCmd>>4 != 2 {
+		return nil, errors.New("proxyproto: unsupported v2 version")
+	}
+	command := verCmd & 0x0F
+
+	famProto := header[13]
+	family := famProto >> 4
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	body := make([]byte, length)
+	if length > 0 {
+		if _, err := readFull(r, body); err != nil {
+			return nil, err
+		}
+	}
+
+	// LOCAL connections (e.g. health checks) carry no useful address.
+	if command == 0x00 {
+		return nil, errNoProxyHeader
+	}
+
+	switch family {
+	case 0x1: // AF_INET
+		if len(body) < 12 {
+			return nil, errors.New("proxyproto: short v2 IPv4 body")
+		}
+		ip := net.IP(body[0:4])
+		port := binary.BigEndian.Uint16(body[8:10])
+		return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+	case 0x2: // AF_INET6
+		if len(body) < 36 {
+			return nil, errors.New("proxyproto: short v2 IPv6 body")
+		}
+		ip := net.IP(body[0:16])
+		port := binary.BigEndian.Uint16(body[32:34])
+		return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+	default:
+		return nil, errors.New("proxyproto: unsupported v2 address family")
+	}
+}
+
+func readFull(r *bufio.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,215 @@
+package broker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIsTrustedProxy(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.168.1.0/24"}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3:5555", true},
+		{"192.168.1.42:5555", true},
+		{"8.8.8.8:5555", false},
+	}
+
+	for _, tt := range tests {
+		addr, err := net.ResolveTCPAddr("tcp", tt.addr)
+		if err != nil {
+			t.Fatalf("ResolveTCPAddr(%q): %v", tt.addr, err)
+		}
+		if got := isTrustedProxy(addr, trusted); got != tt.want {
+			t.Errorf("isTrustedProxy(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+
+	if isTrustedProxy(&net.TCPAddr{IP: net.ParseIP("10.1.2.3")}, nil) {
+		t.Error("isTrustedProxy with no trusted CIDRs should always be false")
+	}
+}
+
+func TestReadProxyHeaderV1(t *testing.T) {
+	r := bufio.NewReader(bytes.NewBufferString("PROXY TCP4 1.2.3.4 5.6.7.8 443 8080\r\nrest"))
+
+	addr, err := readProxyHeader(r)
+	if err != nil {
+		t.Fatalf("readProxyHeader: %v", err)
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || tcpAddr.IP.String() != "1.2.3.4" || tcpAddr.Port != 443 {
+		t.Fatalf("readProxyHeader = %+v, want 1.2.3.4:443", addr)
+	}
+
+	remaining, _ := r.ReadString(0)
+	if remaining != "rest" {
+		t.Errorf("bytes after v1 header = %q, want %q", remaining, "rest")
+	}
+}
+
+func TestReadProxyHeaderV1Unknown(t *testing.T) {
+	r := bufio.NewReader(bytes.NewBufferString("PROXY UNKNOWN\r\n"))
+	if _, err := readProxyHeader(r); err == nil {
+		t.Fatal("readProxyHeader with UNKNOWN source should error")
+	}
+}
+
+func TestReadProxyHeaderNone(t *testing.T) {
+	r := bufio.NewReader(bytes.NewBufferString("\x10\x00\x00\x00CONNECT"))
+	if _, err := readProxyHeader(r); err != errNoProxyHeader {
+		t.Fatalf("readProxyHeader = %v, want errNoProxyHeader", err)
+	}
+}
+
+func buildProxyV2(t *testing.T, family byte, command byte, ip net.IP, port uint16) []byte {
+	t.Helper()
+
+	var body []byte
+	switch family {
+	case 0x1:
+		body = make([]byte, 12)
+		copy(body[0:4], ip.To4())
+		binary.BigEndian.PutUint16(body[8:10], port)
+	case 0x2:
+		body = make([]byte, 36)
+		copy(body[0:16], ip.To16())
+		binary.BigEndian.PutUint16(body[32:34], port)
+	}
+
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command)
+	header = append(header, family<<4)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(body)))
+	header = append(header, length...)
+	header = append(header, body...)
+	return header
+}
+
+func TestReadProxyHeaderV2IPv4(t *testing.T) {
+	data := buildProxyV2(t, 0x1, 0x1, net.ParseIP("1.2.3.4"), 443)
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	addr, err := readProxyHeader(r)
+	if err != nil {
+		t.Fatalf("readProxyHeader: %v", err)
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || tcpAddr.IP.String() != "1.2.3.4" || tcpAddr.Port != 443 {
+		t.Fatalf("readProxyHeader = %+v, want 1.2.3.4:443", addr)
+	}
+}
+
+func TestReadProxyHeaderV2IPv6(t *testing.T) {
+	data := buildProxyV2(t, 0x2, 0x1, net.ParseIP("::1"), 9090)
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	addr, err := readProxyHeader(r)
+	if err != nil {
+		t.Fatalf("readProxyHeader: %v", err)
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || tcpAddr.IP.String() != "::1" || tcpAddr.Port != 9090 {
+		t.Fatalf("readProxyHeader = %+v, want [::1]:9090", addr)
+	}
+}
+
+func TestReadProxyHeaderV2Local(t *testing.T) {
+	data := buildProxyV2(t, 0x1, 0x0, net.ParseIP("1.2.3.4"), 443)
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	if _, err := readProxyHeader(r); err != errNoProxyHeader {
+		t.Fatalf("readProxyHeader(LOCAL) = %v, want errNoProxyHeader", err)
+	}
+}
+
+// fakeConn is a minimal net.Conn backed by a fixed byte stream and a
+// fixed RemoteAddr, enough to drive resolveProxyProtocol without a real
+// socket.
+type fakeConn struct {
+	io.Reader
+	remoteAddr net.Addr
+}
+
+func (c *fakeConn) Write(p []byte) (int, error)        { return len(p), nil }
+func (c *fakeConn) Close() error                       { return nil }
+func (c *fakeConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *fakeConn) RemoteAddr() net.Addr               { return c.remoteAddr }
+func (c *fakeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func trustedAddr(t *testing.T) net.Addr {
+	t.Helper()
+	addr, err := net.ResolveTCPAddr("tcp", "10.1.2.3:5555")
+	if err != nil {
+		t.Fatalf("ResolveTCPAddr: %v", err)
+	}
+	return addr
+}
+
+func TestResolveProxyProtocolOptionalNoHeaderFallsBack(t *testing.T) {
+	b := &Broker{config: &Config{ProxyProtocol: ProxyProtocolOptional, TrustedProxies: []string{"10.0.0.0/8"}}}
+	conn := &fakeConn{Reader: bytes.NewBufferString("CONNECT-ish"), remoteAddr: trustedAddr(t)}
+
+	wrapped, addr, err := b.resolveProxyProtocol(conn)
+	if err != nil {
+		t.Fatalf("resolveProxyProtocol: %v", err)
+	}
+	if addr.String() != conn.remoteAddr.String() {
+		t.Fatalf("resolved addr = %v, want TCP peer address %v", addr, conn.remoteAddr)
+	}
+
+	got := make([]byte, len("CONNECT-ish"))
+	if _, err := io.ReadFull(wrapped, got); err != nil {
+		t.Fatalf("read after fallback: %v", err)
+	}
+	if string(got) != "CONNECT-ish" {
+		t.Fatalf("bytes after fallback = %q, want %q (no bytes should be dropped)", got, "CONNECT-ish")
+	}
+}
+
+// TestResolveProxyProtocolOptionalMalformedHeaderErrors proves a
+// malformed-but-present PROXY header is never silently treated as "no
+// header" in optional mode: readProxyV1 already consumed it off the
+// wire by the time it errors, so falling back would feed those
+// already-read bytes into the MQTT CONNECT parser as corrupted data.
+func TestResolveProxyProtocolOptionalMalformedHeaderErrors(t *testing.T) {
+	b := &Broker{config: &Config{ProxyProtocol: ProxyProtocolOptional, TrustedProxies: []string{"10.0.0.0/8"}}}
+	conn := &fakeConn{Reader: bytes.NewBufferString("PROXY UNKNOWN\r\n"), remoteAddr: trustedAddr(t)}
+
+	if _, _, err := b.resolveProxyProtocol(conn); err == nil {
+		t.Fatal("resolveProxyProtocol with a malformed PROXY header should error even in optional mode")
+	}
+}
+
+func TestResolveProxyProtocolRequiredValidHeader(t *testing.T) {
+	b := &Broker{config: &Config{ProxyProtocol: ProxyProtocolRequired, TrustedProxies: []string{"10.0.0.0/8"}}}
+	conn := &fakeConn{Reader: bytes.NewBufferString("PROXY TCP4 1.2.3.4 5.6.7.8 443 8080\r\n"), remoteAddr: trustedAddr(t)}
+
+	_, addr, err := b.resolveProxyProtocol(conn)
+	if err != nil {
+		t.Fatalf("resolveProxyProtocol: %v", err)
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || tcpAddr.IP.String() != "1.2.3.4" || tcpAddr.Port != 443 {
+		t.Fatalf("resolveProxyProtocol addr = %+v, want 1.2.3.4:443", addr)
+	}
+}
+
+func TestResolveProxyProtocolRequiredNoHeaderErrors(t *testing.T) {
+	b := &Broker{config: &Config{ProxyProtocol: ProxyProtocolRequired, TrustedProxies: []string{"10.0.0.0/8"}}}
+	conn := &fakeConn{Reader: bytes.NewBufferString("CONNECT-ish"), remoteAddr: trustedAddr(t)}
+
+	if _, _, err := b.resolveProxyProtocol(conn); err == nil {
+		t.Fatal("resolveProxyProtocol in required mode with no header should error")
+	}
+}
@@ -0,0 +1,74 @@
+package topics
+
+import "sync"
+
+// RetainedMessage is the last retained payload published on a topic.
+type RetainedMessage struct {
+	Topic   string
+	Payload []byte
+	Qos     byte
+}
+
+// RetainedStore keeps the single last retained message per exact topic
+// name (retained messages are never stored under a filter).
+type RetainedStore struct {
+	mu      sync.RWMutex
+	byTopic map[string]RetainedMessage
+}
+
+// NewRetainedStore returns an empty retained-message store.
+func NewRetainedStore() *RetainedStore {
+	return &RetainedStore{byTopic: make(map[string]RetainedMessage)}
+}
+
+// Set stores msg as the retained message for its topic. A zero-length
+// payload clears any retained message for that topic instead, per
+// MQTT-3.3.1-10/11.
+func (s *RetainedStore) Set(msg RetainedMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(msg.Payload) == 0 {
+		delete(s.byTopic, msg.Topic)
+		return
+	}
+	s.byTopic[msg.Topic] = msg
+}
+
+// Match returns every retained message whose topic matches filter.
+func (s *RetainedStore) Match(filter string) []RetainedMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []RetainedMessage
+	filterLevels := splitTopic(filter)
+	for topic, msg := range s.byTopic {
+		if retainedMatches(filterLevels, splitTopic(topic)) {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+func retainedMatches(filterLevels, topicLevels []string) bool {
+	isSys := len(topicLevels) > 0 && len(topicLevels[0]) > 0 && topicLevels[0][0] == '$'
+
+	for i, f := range filterLevels {
+		if f == multiLevelWildcard {
+			return !(isSys && i == 0)
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if f == singleLevelWildcard {
+			if isSys && i == 0 {
+				return false
+			}
+			continue
+		}
+		if f != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
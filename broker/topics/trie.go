@@ -0,0 +1,209 @@
+// Package topics implements MQTT topic matching: a concurrent trie keyed
+// by '/'-separated levels that supports the '+' (single-level) and '#'
+// (multi-level) wildcards, plus the '$SYS'-prefix isolation rule (a
+// leading wildcard never matches a topic starting with '$').
+package topics
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	singleLevelWildcard = "+"
+	multiLevelWildcard  = "#"
+	sysPrefix           = "$"
+)
+
+// Subscription is one (client, granted QoS) pair matched at a filter.
+type Subscription struct {
+	ClientID string
+	Qos      byte
+}
+
+// node is one level of the trie. A filter like "a/+/c" creates nodes for
+// "a", "+" and "c" with subs stored on the last one.
+type node struct {
+	children map[string]*node
+	subs     map[string]byte // clientID -> granted QoS
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+// Tree is a concurrent topic trie. The zero value is not usable; use New.
+type Tree struct {
+	mu   sync.RWMutex
+	root *node
+}
+
+// New returns an empty topic trie.
+func New() *Tree {
+	return &Tree{root: newNode()}
+}
+
+func splitTopic(topic string) []string {
+	return strings.Split(topic, "/")
+}
+
+// Subscribe inserts (clientID, filter, requestedQoS) into the trie. MQTT
+// has no notion of per-client QoS downgrade on the broker side here, so
+// the granted QoS is simply the requested one, clamped to what this
+// broker supports (QoS 0 only, for now).
+func (t *Tree) Subscribe(clientID, filter string, qos byte) byte {
+	if qos > 0 {
+		qos = 0
+	}
+
+	levels := splitTopic(filter)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := t.root
+	for _, level := range levels {
+		child, ok := n.children[level]
+		if !ok {
+			child = newNode()
+			n.children[level] = child
+		}
+		n = child
+	}
+	if n.subs == nil {
+		n.subs = make(map[string]byte)
+	}
+	n.subs[clientID] = qos
+
+	return qos
+}
+
+// Unsubscribe removes clientID's interest in filter.
+func (t *Tree) Unsubscribe(clientID, filter string) {
+	levels := splitTopic(filter)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.unsubscribe(t.root, levels, clientID)
+}
+
+func (t *Tree) unsubscribe(n *node, levels []string, clientID string) bool {
+	if len(levels) == 0 {
+		delete(n.subs, clientID)
+		return len(n.subs) == 0 && len(n.children) == 0
+	}
+
+	level := levels[0]
+	child, ok := n.children[level]
+	if !ok {
+		return false
+	}
+	if t.unsubscribe(child, levels[1:], clientID) {
+		delete(n.children, level)
+	}
+	return len(n.subs) == 0 && len(n.children) == 0
+}
+
+// UnsubscribeAll removes every filter clientID is subscribed to. Callers
+// that don't track a client's filter set themselves (e.g. on disconnect)
+// can use this instead of calling Unsubscribe per topic.
+func (t *Tree) UnsubscribeAll(clientID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pruneClient(t.root, clientID)
+}
+
+func pruneClient(n *node, clientID string) bool {
+	delete(n.subs, clientID)
+	for level, child := range n.children {
+		if pruneClient(child, clientID) {
+			delete(n.children, level)
+		}
+	}
+	return len(n.subs) == 0 && len(n.children) == 0
+}
+
+// Match returns every subscriber whose filter matches topic.
+func (t *Tree) Match(topic string) []Subscription {
+	levels := splitTopic(topic)
+	isSys := strings.HasPrefix(topic, sysPrefix)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var out []Subscription
+	matchNode(t.root, levels, isSys, true, &out)
+	return out
+}
+
+// matchNode walks n against the remaining topic levels. atRoot is true
+// only for the very first level, which is where the $SYS isolation rule
+// applies: '+' and '#' at the root never match a '$'-prefixed topic.
+func matchNode(n *node, levels []string, isSys, atRoot bool, out *[]Subscription) {
+	if len(levels) == 0 {
+		for clientID, qos := range n.subs {
+			*out = append(*out, Subscription{ClientID: clientID, Qos: qos})
+		}
+		// Per MQTT 4.7.1.2, "sport/#" must also match the parent level
+		// itself ("sport"), not just anything under it; that subscription
+		// lives on the "#" child of this node.
+		if !(isSys && atRoot) {
+			if child, ok := n.children[multiLevelWildcard]; ok {
+				for clientID, qos := range child.subs {
+					*out = append(*out, Subscription{ClientID: clientID, Qos: qos})
+				}
+			}
+		}
+		return
+	}
+
+	level := levels[0]
+	rest := levels[1:]
+
+	if child, ok := n.children[level]; ok {
+		matchNode(child, rest, isSys, false, out)
+	}
+
+	if !(isSys && atRoot) {
+		if child, ok := n.children[singleLevelWildcard]; ok {
+			matchNode(child, rest, isSys, false, out)
+		}
+		if child, ok := n.children[multiLevelWildcard]; ok {
+			for clientID, qos := range child.subs {
+				*out = append(*out, Subscription{ClientID: clientID, Qos: qos})
+			}
+		}
+	}
+}
+
+// FilterSubscription is one (topic filter, client, QoS) entry, as
+// returned by All.
+type FilterSubscription struct {
+	Filter   string
+	ClientID string
+	Qos      byte
+}
+
+// All enumerates every subscription currently held in the trie,
+// reconstructing each one's filter string. It's meant for
+// introspection (e.g. an admin API), not the PUBLISH hot path.
+func (t *Tree) All() []FilterSubscription {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var out []FilterSubscription
+	collect(t.root, nil, &out)
+	return out
+}
+
+func collect(n *node, levels []string, out *[]FilterSubscription) {
+	if len(n.subs) > 0 {
+		filter := strings.Join(levels, "/")
+		for clientID, qos := range n.subs {
+			*out = append(*out, FilterSubscription{Filter: filter, ClientID: clientID, Qos: qos})
+		}
+	}
+	for level, child := range n.children {
+		collect(child, append(levels, level), out)
+	}
+}
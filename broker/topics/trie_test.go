@@ -0,0 +1,93 @@
+package topics
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatchExactAndWildcards(t *testing.T) {
+	tr := New()
+	tr.Subscribe("c1", "a/b/c", 0)
+	tr.Subscribe("c2", "a/+/c", 0)
+	tr.Subscribe("c3", "a/#", 0)
+	tr.Subscribe("c4", "#", 0)
+	tr.Subscribe("c5", "$SYS/stats", 0)
+
+	got := clientIDs(tr.Match("a/b/c"))
+	want := map[string]bool{"c1": true, "c2": true, "c3": true, "c4": true}
+	if len(got) != len(want) {
+		t.Fatalf("Match(a/b/c) = %v, want %v", got, want)
+	}
+	for id := range want {
+		if !got[id] {
+			t.Errorf("Match(a/b/c) missing subscriber %q", id)
+		}
+	}
+
+	sysMatches := clientIDs(tr.Match("$SYS/stats"))
+	if !sysMatches["c5"] || sysMatches["c4"] {
+		t.Errorf("$SYS isolation violated: %v", sysMatches)
+	}
+}
+
+func TestMatchMultiLevelWildcardMatchesParentLevel(t *testing.T) {
+	tr := New()
+	tr.Subscribe("c1", "sport/#", 0)
+
+	got := clientIDs(tr.Match("sport"))
+	if !got["c1"] {
+		t.Fatalf("Match(sport) = %v, want c1 (sport/# must also match the bare parent level)", got)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	tr := New()
+	tr.Subscribe("c1", "a/b", 0)
+	tr.Unsubscribe("c1", "a/b")
+
+	if got := tr.Match("a/b"); len(got) != 0 {
+		t.Fatalf("Match(a/b) after Unsubscribe = %v, want none", got)
+	}
+}
+
+func TestRetainedClearedByEmptyPayload(t *testing.T) {
+	s := NewRetainedStore()
+	s.Set(RetainedMessage{Topic: "a/b", Payload: []byte("1")})
+	if len(s.Match("a/+")) != 1 {
+		t.Fatalf("expected one retained match before clear")
+	}
+
+	s.Set(RetainedMessage{Topic: "a/b", Payload: nil})
+	if got := s.Match("a/+"); len(got) != 0 {
+		t.Fatalf("retained message not cleared: %v", got)
+	}
+}
+
+func clientIDs(subs []Subscription) map[string]bool {
+	out := make(map[string]bool, len(subs))
+	for _, s := range subs {
+		out[s.ClientID] = true
+	}
+	return out
+}
+
+func BenchmarkMatch100kMixedWildcards(b *testing.B) {
+	tr := New()
+	for i := 0; i < 100000; i++ {
+		switch i % 4 {
+		case 0:
+			tr.Subscribe(fmt.Sprintf("c%d", i), fmt.Sprintf("a/%d/c", i), 0)
+		case 1:
+			tr.Subscribe(fmt.Sprintf("c%d", i), fmt.Sprintf("a/+/%d", i), 0)
+		case 2:
+			tr.Subscribe(fmt.Sprintf("c%d", i), "a/#", 0)
+		default:
+			tr.Subscribe(fmt.Sprintf("c%d", i), fmt.Sprintf("a/b/%d/#", i), 0)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Match("a/b/c")
+	}
+}
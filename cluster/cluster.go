@@ -0,0 +1,375 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+)
+
+const (
+	leaveTimeout  = 5 * time.Second
+	raftTimeout   = 10 * time.Second
+	snapshotCount = 2
+)
+
+// Cluster makes a set of hmq nodes act as one logical broker: memberlist
+// gossip handles discovery, and a Raft group replicates the authoritative
+// client-id/topic ownership Table so any node can tell which peer to
+// forward a PUBLISH to.
+type Cluster struct {
+	config   Config
+	nodeName string
+
+	discovery Discovery
+	raft      *raft.Raft
+	table     *Table
+
+	fwdServer *forwardServer
+
+	mu      sync.RWMutex
+	clients map[string]*forwardClient // node name -> open forward connection
+
+	stopMembership chan struct{}
+}
+
+// membershipReconcileInterval is how often the current Raft leader
+// checks gossip membership for nodes that aren't yet Raft voters.
+const membershipReconcileInterval = 2 * time.Second
+
+// raftBindAddrPort resolves the host/port the Raft transport binds to,
+// applying the same BindAddr/BindPort+2 fallback startRaft uses, so
+// callers that need it before startRaft runs (to advertise it over
+// gossip) compute the identical value.
+func raftBindAddrPort(config Config) (string, int) {
+	addr := config.RaftBindAddr
+	if addr == "" {
+		addr = config.BindAddr
+	}
+	port := config.RaftBindPort
+	if port == 0 {
+		port = config.BindPort + 2
+	}
+	return addr, port
+}
+
+// New builds and starts a Cluster node. handle is invoked for every
+// Envelope forwarded to this node by a peer; the caller (the broker) is
+// responsible for delivering it to its local subscribers.
+func New(config Config, handle ForwardFunc) (*Cluster, error) {
+	nodeName := config.NodeName
+	if nodeName == "" {
+		return nil, fmt.Errorf("cluster: NodeName is required")
+	}
+
+	raftBindAddr, raftBindPort := raftBindAddrPort(config)
+	fwdAddr := raftAddr(config.BindAddr, config.BindPort+1)
+	discovery, err := NewMemberlistDiscovery(nodeName, config.BindAddr, config.BindPort, raftAddr(raftBindAddr, raftBindPort), fwdAddr)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: start gossip: %w", err)
+	}
+
+	r, fsm, err := startRaft(config, nodeName)
+	if err != nil {
+		discovery.Shutdown()
+		return nil, fmt.Errorf("cluster: start raft: %w", err)
+	}
+
+	applyFn := func(cmd command) error {
+		data, err := json.Marshal(cmd)
+		if err != nil {
+			return err
+		}
+		return r.Apply(data, raftTimeout).Error()
+	}
+	fwdServer, err := serveForward(fwdAddr, handle, applyFn)
+	if err != nil {
+		discovery.Shutdown()
+		return nil, fmt.Errorf("cluster: start forward listener: %w", err)
+	}
+
+	c := &Cluster{
+		config:         config,
+		nodeName:       nodeName,
+		discovery:      discovery,
+		raft:           r,
+		table:          fsm.table,
+		fwdServer:      fwdServer,
+		clients:        make(map[string]*forwardClient),
+		stopMembership: make(chan struct{}),
+	}
+
+	if len(config.Members) > 0 {
+		if _, err := discovery.Join(config.Members); err != nil {
+			return nil, fmt.Errorf("cluster: join gossip: %w", err)
+		}
+	}
+
+	go c.watchMembership()
+
+	return c, nil
+}
+
+// watchMembership periodically reconciles gossip's view of who's alive
+// into Raft's voter configuration: any node Discovery knows about that
+// isn't yet a Raft voter gets added via AddVoter. Only the current Raft
+// leader can successfully apply a configuration change, so this is a
+// no-op on every other node; whichever node is leader at the time picks
+// up the reconciliation on its next tick.
+func (c *Cluster) watchMembership() {
+	ticker := time.NewTicker(membershipReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.reconcileVoters()
+		case <-c.stopMembership:
+			return
+		}
+	}
+}
+
+func (c *Cluster) reconcileVoters() {
+	if c.raft.State() != raft.Leader {
+		return
+	}
+
+	future := c.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return
+	}
+
+	existing := make(map[raft.ServerID]bool, len(future.Configuration().Servers))
+	for _, srv := range future.Configuration().Servers {
+		existing[srv.ID] = true
+	}
+
+	for _, m := range c.discovery.Members() {
+		if m.RaftAddr == "" || existing[raft.ServerID(m.Name)] {
+			continue
+		}
+		c.raft.AddVoter(raft.ServerID(m.Name), raft.ServerAddress(m.RaftAddr), 0, 0)
+	}
+}
+
+func startRaft(config Config, nodeName string) (*raft.Raft, *fsm, error) {
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(nodeName)
+
+	bindAddr, bindPort := raftBindAddrPort(config)
+
+	addr := raftAddr(bindAddr, bindPort)
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transport, err := raft.NewTCPTransport(addr, tcpAddr, 3, raftTimeout, os.Stderr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataDir := config.RaftDataDir
+	if dataDir == "" {
+		dataDir, err = ioutil.TempDir("", "hmq-raft-"+nodeName)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(dataDir, snapshotCount, os.Stderr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	boltStore, err := raftboltdb.NewBoltStore(dataDir + "/raft.db")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store := newFSM()
+	r, err := raft.NewRaft(raftConfig, store, boltStore, boltStore, snapshots, transport)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if config.Bootstrap {
+		cfg := raft.Configuration{
+			Servers: []raft.Server{
+				{ID: raftConfig.LocalID, Address: transport.LocalAddr()},
+			},
+		}
+		r.BootstrapCluster(cfg)
+	}
+
+	return r, store, nil
+}
+
+// apply replicates cmd through Raft. Only the leader can append to the
+// Raft log, so a follower forwards cmd to whichever node is currently
+// leader instead of calling raft.Apply itself and failing with
+// raft.ErrNotLeader; that forwarded call runs through the same
+// BrokerService.Apply RPC path serveForward registers on every node.
+func (c *Cluster) apply(cmd command) error {
+	if c.raft.State() == raft.Leader {
+		data, err := json.Marshal(cmd)
+		if err != nil {
+			return err
+		}
+		return c.raft.Apply(data, raftTimeout).Error()
+	}
+
+	leaderAddr := c.raft.Leader()
+	if leaderAddr == "" {
+		return raft.ErrNotLeader
+	}
+
+	fwdAddr, err := c.fwdAddrForRaftAddr(string(leaderAddr))
+	if err != nil {
+		return err
+	}
+	return forwardApply(fwdAddr, cmd)
+}
+
+// fwdAddrForRaftAddr resolves the leader's Raft transport address to its
+// forward-RPC address by matching it against gossip membership, the
+// same source forwardClientFor resolves node names against. Raft only
+// gives apply the leader's RaftAddr, not its node name, so the lookup is
+// keyed on RaftAddr here instead of Name.
+func (c *Cluster) fwdAddrForRaftAddr(raftAddr string) (string, error) {
+	for _, m := range c.discovery.Members() {
+		if m.RaftAddr == raftAddr {
+			if m.FwdAddr == "" {
+				return "", fmt.Errorf("cluster: member %s has no forward address", m.Name)
+			}
+			return m.FwdAddr, nil
+		}
+	}
+	return "", fmt.Errorf("cluster: no member advertising raft address %s", raftAddr)
+}
+
+// AddClient replicates session ownership for clientID to every node, so
+// a duplicate CONNECT elsewhere in the cluster can be rejected the same
+// way a local duplicate is today.
+func (c *Cluster) AddClient(clientID string) error {
+	return c.apply(command{Kind: cmdAddClient, ClientID: clientID, Node: c.nodeName})
+}
+
+// DeleteClient removes clientID's session ownership from the replicated
+// table.
+func (c *Cluster) DeleteClient(clientID string) error {
+	return c.apply(command{Kind: cmdDeleteClient, ClientID: clientID, Node: c.nodeName})
+}
+
+// Subscribe records that clientID, owned by this node, wants topic.
+func (c *Cluster) Subscribe(clientID, topic string) error {
+	return c.apply(command{Kind: cmdSubscribe, ClientID: clientID, Node: c.nodeName, Topic: topic})
+}
+
+// Unsubscribe removes clientID's interest in topic.
+func (c *Cluster) Unsubscribe(clientID, topic string) error {
+	return c.apply(command{Kind: cmdUnsubscribe, ClientID: clientID, Node: c.nodeName, Topic: topic})
+}
+
+// Owner reports which node holds clientID's session, if any.
+func (c *Cluster) Owner(clientID string) (string, bool) {
+	return c.table.Owner(clientID)
+}
+
+// Forward ships env to every remote node with a matching subscriber for
+// env.Topic, or, for a retained env, to every remote gossip member so
+// each node keeps the retained message, opening (and caching) a forward
+// connection as needed.
+func (c *Cluster) Forward(env Envelope) error {
+	nodes := c.table.Subscribers(env.Topic, c.nodeName)
+	if env.Retain {
+		nodes = nil
+		for _, m := range c.discovery.Members() {
+			if m.Name != c.nodeName {
+				nodes = append(nodes, m.Name)
+			}
+		}
+	}
+
+	var firstErr error
+	for _, node := range nodes {
+		client, err := c.forwardClientFor(node)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if err := client.Forward(env); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (c *Cluster) forwardClientFor(node string) (*forwardClient, error) {
+	c.mu.RLock()
+	client, ok := c.clients[node]
+	c.mu.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[node]; ok {
+		return client, nil
+	}
+
+	fwdAddr, err := c.fwdAddrForNode(node)
+	if err != nil {
+		return nil, err
+	}
+
+	newClient, err := dialForward(fwdAddr)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[node] = newClient
+	return newClient, nil
+}
+
+// fwdAddrForNode resolves node, a node name as recorded in the Table (and
+// in gossip membership), to the forward-RPC address it advertised over
+// gossip.
+func (c *Cluster) fwdAddrForNode(node string) (string, error) {
+	for _, m := range c.discovery.Members() {
+		if m.Name == node {
+			if m.FwdAddr == "" {
+				return "", fmt.Errorf("cluster: member %s has no forward address", node)
+			}
+			return m.FwdAddr, nil
+		}
+	}
+	return "", fmt.Errorf("cluster: no member named %s", node)
+}
+
+// Shutdown leaves the gossip pool and stops the local Raft/forward
+// listeners.
+func (c *Cluster) Shutdown() error {
+	close(c.stopMembership)
+
+	c.mu.Lock()
+	for _, client := range c.clients {
+		client.Close()
+	}
+	c.mu.Unlock()
+
+	c.fwdServer.close()
+	c.raft.Shutdown()
+	return c.discovery.Shutdown()
+}
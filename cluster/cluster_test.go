@@ -0,0 +1,155 @@
+package cluster
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRaftBindAddrPortDefaults(t *testing.T) {
+	addr, port := raftBindAddrPort(Config{BindAddr: "127.0.0.1", BindPort: 8301})
+	if addr != "127.0.0.1" || port != 8303 {
+		t.Fatalf("raftBindAddrPort = (%s, %d), want (127.0.0.1, 8303)", addr, port)
+	}
+}
+
+func TestRaftBindAddrPortOverrides(t *testing.T) {
+	addr, port := raftBindAddrPort(Config{
+		BindAddr:     "127.0.0.1",
+		BindPort:     8301,
+		RaftBindAddr: "10.0.0.1",
+		RaftBindPort: 9000,
+	})
+	if addr != "10.0.0.1" || port != 9000 {
+		t.Fatalf("raftBindAddrPort = (%s, %d), want (10.0.0.1, 9000)", addr, port)
+	}
+}
+
+// fakeDiscovery is a Discovery stub that reports a fixed member list,
+// used to test Cluster's node-name/Raft-address resolution without
+// standing up real memberlist gossip.
+type fakeDiscovery struct {
+	members []Member
+}
+
+func (f fakeDiscovery) Join([]string) (int, error) { return 0, nil }
+func (f fakeDiscovery) Members() []Member          { return f.members }
+func (f fakeDiscovery) Shutdown() error            { return nil }
+
+func TestFwdAddrForNode(t *testing.T) {
+	c := &Cluster{discovery: fakeDiscovery{members: []Member{
+		{Name: "7f3c2b1a-node", RaftAddr: "127.0.0.1:8303", FwdAddr: "127.0.0.1:8302"},
+	}}}
+
+	addr, err := c.fwdAddrForNode("7f3c2b1a-node")
+	if err != nil {
+		t.Fatalf("fwdAddrForNode: %v", err)
+	}
+	if addr != "127.0.0.1:8302" {
+		t.Fatalf("fwdAddrForNode = %q, want 127.0.0.1:8302", addr)
+	}
+}
+
+func TestFwdAddrForNodeUnknown(t *testing.T) {
+	c := &Cluster{discovery: fakeDiscovery{}}
+	if _, err := c.fwdAddrForNode("does-not-exist"); err == nil {
+		t.Fatal("fwdAddrForNode for an unknown node should error")
+	}
+}
+
+func TestFwdAddrForNodeNoFwdAddr(t *testing.T) {
+	c := &Cluster{discovery: fakeDiscovery{members: []Member{
+		{Name: "node-a", RaftAddr: "127.0.0.1:8303"},
+	}}}
+	if _, err := c.fwdAddrForNode("node-a"); err == nil {
+		t.Fatal("fwdAddrForNode for a member with no FwdAddr should error")
+	}
+}
+
+func TestFwdAddrForRaftAddr(t *testing.T) {
+	c := &Cluster{discovery: fakeDiscovery{members: []Member{
+		{Name: "node-a", RaftAddr: "127.0.0.1:8303", FwdAddr: "127.0.0.1:8302"},
+	}}}
+
+	addr, err := c.fwdAddrForRaftAddr("127.0.0.1:8303")
+	if err != nil {
+		t.Fatalf("fwdAddrForRaftAddr: %v", err)
+	}
+	if addr != "127.0.0.1:8302" {
+		t.Fatalf("fwdAddrForRaftAddr = %q, want 127.0.0.1:8302", addr)
+	}
+}
+
+func TestFwdAddrForRaftAddrUnknown(t *testing.T) {
+	c := &Cluster{discovery: fakeDiscovery{}}
+	if _, err := c.fwdAddrForRaftAddr("127.0.0.1:8303"); err == nil {
+		t.Fatal("fwdAddrForRaftAddr for an unknown raft address should error")
+	}
+}
+
+// TestForwardResolvesRealisticNodeNames proves Forward can resolve two
+// differently-named nodes (UUID-style names, not host:port pairs) to
+// their forward-RPC addresses via gossip metadata and dial between them,
+// the gap a bare dialForward(node) call used to paper over.
+func TestForwardResolvesRealisticNodeNames(t *testing.T) {
+	var mu sync.Mutex
+	var received []Envelope
+
+	srv, err := serveForward("127.0.0.1:0", func(env Envelope) {
+		mu.Lock()
+		received = append(received, env)
+		mu.Unlock()
+	}, func(command) error { return nil })
+	if err != nil {
+		t.Fatalf("serveForward: %v", err)
+	}
+	defer srv.close()
+
+	const localNode = "6f1e9c3a-local-node"
+	const remoteNode = "a02d7e88-remote-node"
+
+	table := newTable()
+	table.addClient("peer-client", remoteNode)
+	table.subscribe("peer-client", remoteNode, "a/b")
+
+	c := &Cluster{
+		nodeName: localNode,
+		table:    table,
+		clients:  make(map[string]*forwardClient),
+		discovery: fakeDiscovery{members: []Member{
+			{Name: localNode, RaftAddr: "127.0.0.1:8303", FwdAddr: "127.0.0.1:8302"},
+			{Name: remoteNode, RaftAddr: "127.0.0.1:9303", FwdAddr: srv.lis.Addr().String()},
+		}},
+	}
+	defer func() {
+		for _, client := range c.clients {
+			client.Close()
+		}
+	}()
+
+	want := Envelope{OriginClientID: "c1", Topic: "a/b", Payload: []byte("hi"), Qos: 0}
+	if err := c.Forward(want); err != nil {
+		t.Fatalf("Forward: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for forwarded envelope")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	got := received[0]
+	mu.Unlock()
+	if got.Topic != want.Topic || string(got.Payload) != string(want.Payload) {
+		t.Fatalf("received %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,38 @@
+package cluster
+
+// Config controls how a broker node joins and participates in a cluster.
+// It is embedded into broker.Config rather than duplicated there so a
+// single JSON config file can configure both the MQTT listener and the
+// cluster layer.
+type Config struct {
+	// Enabled turns the cluster subsystem on. When false, every other
+	// field is ignored and the broker behaves as a standalone node.
+	Enabled bool `json:"enabled"`
+
+	// NodeName uniquely identifies this node in gossip and Raft. Defaults
+	// to the broker's generated id when empty.
+	NodeName string `json:"nodeName"`
+
+	// BindAddr/BindPort is the address the gossip (memberlist) transport
+	// listens on.
+	BindAddr string `json:"bindAddr"`
+	BindPort int    `json:"bindPort"`
+
+	// Members is a seed list of host:port gossip addresses used to join
+	// an existing cluster. It may be empty for the first node.
+	Members []string `json:"members"`
+
+	// RaftBindAddr is the address the Raft transport listens on. Defaults
+	// to BindAddr with RaftBindPort when empty.
+	RaftBindAddr string `json:"raftBindAddr"`
+	RaftBindPort int    `json:"raftBindPort"`
+
+	// RaftDataDir is where the Raft log, stable store and snapshots are
+	// kept. A temp directory is used when empty, which is only suitable
+	// for a single-node bootstrap/testing setup.
+	RaftDataDir string `json:"raftDataDir"`
+
+	// Bootstrap tells this node to bootstrap a brand-new single-node Raft
+	// cluster. Only the first node of a fresh cluster should set this.
+	Bootstrap bool `json:"bootstrap"`
+}
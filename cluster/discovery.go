@@ -0,0 +1,136 @@
+package cluster
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// Member is one node's gossip identity, together with the addresses it
+// advertised via gossip metadata. Cluster uses RaftAddr to reconcile
+// gossip membership into Raft's voter configuration, and FwdAddr to
+// dial that node's BrokerService when forwarding a PUBLISH or a
+// leader-apply request to it.
+type Member struct {
+	Name     string
+	RaftAddr string
+	FwdAddr  string
+}
+
+// memberMeta is the JSON payload advertised as this node's memberlist
+// metadata; it's how a peer's Members() call learns where this node's
+// Raft transport and forward-RPC listener are, without a separate side
+// channel.
+type memberMeta struct {
+	RaftAddr string `json:"r"`
+	FwdAddr  string `json:"f"`
+}
+
+// Discovery finds the other members of a cluster; Cluster polls Members
+// to learn as they come and go. The gossip (memberlist) implementation below is the
+// only one today; a hashicorp/serf implementation can satisfy the same
+// interface later without touching Cluster.
+type Discovery interface {
+	// Join contacts the given seed addresses and merges their membership
+	// into the local view.
+	Join(seeds []string) (int, error)
+	// Members returns the nodes currently believed to be alive, along
+	// with the Raft address each one is advertising.
+	Members() []Member
+	// Shutdown leaves the cluster and releases the transport.
+	Shutdown() error
+}
+
+// memberlistDiscovery implements Discovery on top of hashicorp/memberlist
+// gossip.
+type memberlistDiscovery struct {
+	ml *memberlist.Memberlist
+}
+
+// NewMemberlistDiscovery starts a gossip transport bound to bindAddr:bindPort
+// under the given node name and returns a Discovery backed by it. raftAddr
+// and fwdAddr are advertised to peers as gossip node metadata, so a
+// peer's Members() call can tell Cluster where this node's Raft
+// transport and forward-RPC listener are without a separate side
+// channel.
+func NewMemberlistDiscovery(nodeName, bindAddr string, bindPort int, raftAddr, fwdAddr string) (Discovery, error) {
+	conf := memberlist.DefaultLANConfig()
+	if nodeName != "" {
+		conf.Name = nodeName
+	}
+	if bindAddr != "" {
+		conf.BindAddr = bindAddr
+	}
+	if bindPort != 0 {
+		conf.BindPort = bindPort
+		conf.AdvertisePort = bindPort
+	}
+	conf.Delegate = &memberDelegate{meta: memberMeta{RaftAddr: raftAddr, FwdAddr: fwdAddr}}
+
+	ml, err := memberlist.Create(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memberlistDiscovery{ml: ml}, nil
+}
+
+func (d *memberlistDiscovery) Join(seeds []string) (int, error) {
+	if len(seeds) == 0 {
+		return 0, nil
+	}
+	return d.ml.Join(seeds)
+}
+
+func (d *memberlistDiscovery) Members() []Member {
+	members := d.ml.Members()
+	out := make([]Member, 0, len(members))
+	for _, m := range members {
+		var meta memberMeta
+		// A peer mid-join may not have gossiped its metadata yet; treat
+		// that the same as an empty meta rather than failing Members().
+		json.Unmarshal(m.Meta, &meta)
+		out = append(out, Member{Name: m.Name, RaftAddr: meta.RaftAddr, FwdAddr: meta.FwdAddr})
+	}
+	return out
+}
+
+func (d *memberlistDiscovery) Shutdown() error {
+	if err := d.ml.Leave(leaveTimeout); err != nil {
+		return err
+	}
+	return d.ml.Shutdown()
+}
+
+// memberDelegate advertises this node's Raft transport and forward-RPC
+// addresses as memberlist node metadata, so a peer learning about this
+// node through gossip can turn RaftAddr into a raft.AddVoter call and
+// FwdAddr into a BrokerService dial target. It implements
+// memberlist.Delegate; only NodeMeta does anything here, since Cluster
+// has no use yet for user messages or push/pull state transfer.
+type memberDelegate struct {
+	meta memberMeta
+}
+
+func (d *memberDelegate) NodeMeta(limit int) []byte {
+	meta, err := json.Marshal(d.meta)
+	if err != nil || len(meta) > limit {
+		return nil
+	}
+	return meta
+}
+
+func (d *memberDelegate) NotifyMsg([]byte) {}
+
+func (d *memberDelegate) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+
+func (d *memberDelegate) LocalState(join bool) []byte { return nil }
+
+func (d *memberDelegate) MergeRemoteState(buf []byte, join bool) {}
+
+// raftAddr joins a host and port the way memberlist/raft transports expect.
+func raftAddr(host string, port int) string {
+	return strings.Join([]string{host, strconv.Itoa(port)}, ":")
+}
@@ -0,0 +1,113 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/fhmq/hmq/broker/topics"
+	"github.com/hashicorp/raft"
+)
+
+// commandKind identifies the operation a Raft log entry replicates.
+type commandKind string
+
+const (
+	cmdAddClient    commandKind = "add_client"
+	cmdDeleteClient commandKind = "delete_client"
+	cmdSubscribe    commandKind = "subscribe"
+	cmdUnsubscribe  commandKind = "unsubscribe"
+)
+
+// command is the JSON-encoded payload applied to every node's FSM.
+type command struct {
+	Kind     commandKind `json:"kind"`
+	ClientID string      `json:"clientId"`
+	Node     string      `json:"node"`
+	Topic    string      `json:"topic,omitempty"`
+}
+
+// fsm adapts Table to raft.FSM so the subscription table is replicated
+// identically to every voter in the cluster.
+type fsm struct {
+	table *Table
+}
+
+func newFSM() *fsm {
+	return &fsm{table: newTable()}
+}
+
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	var cmd command
+	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		return err
+	}
+
+	switch cmd.Kind {
+	case cmdAddClient:
+		f.table.addClient(cmd.ClientID, cmd.Node)
+	case cmdDeleteClient:
+		f.table.deleteClient(cmd.ClientID)
+	case cmdSubscribe:
+		f.table.subscribe(cmd.ClientID, cmd.Node, cmd.Topic)
+	case cmdUnsubscribe:
+		f.table.unsubscribe(cmd.ClientID, cmd.Topic)
+	}
+
+	return nil
+}
+
+// fsmSnapshot is the point-in-time copy of Table persisted by Raft.
+type fsmSnapshot struct {
+	Owners map[string]string           `json:"owners"`
+	Subs   []topics.FilterSubscription `json:"subs"`
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.table.mu.RLock()
+	defer f.table.mu.RUnlock()
+
+	snap := fsmSnapshot{
+		Owners: make(map[string]string, len(f.table.owners)),
+		Subs:   f.table.tree.All(),
+	}
+	for k, v := range f.table.owners {
+		snap.Owners[k] = v
+	}
+
+	return snap, nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	var snap fsmSnapshot
+	if err := json.NewDecoder(rc).Decode(&snap); err != nil {
+		return err
+	}
+
+	f.table.mu.Lock()
+	defer f.table.mu.Unlock()
+
+	f.table.owners = snap.Owners
+	if f.table.owners == nil {
+		f.table.owners = make(map[string]string)
+	}
+
+	f.table.tree = topics.New()
+	for _, sub := range snap.Subs {
+		f.table.tree.Subscribe(sub.ClientID, sub.Filter, sub.Qos)
+	}
+
+	return nil
+}
+
+func (s fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	err := json.NewEncoder(sink).Encode(s)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s fsmSnapshot) Release() {}
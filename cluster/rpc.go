@@ -0,0 +1,232 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+)
+
+// Envelope carries a single forwarded MQTT PUBLISH between nodes, along
+// with enough metadata for the receiving node to avoid looping it back
+// to where it came from.
+type Envelope struct {
+	OriginClientID string
+	Topic          string
+	Payload        []byte
+	Qos            byte
+	Retain         bool
+}
+
+// ForwardFunc handles an Envelope received from a peer node.
+type ForwardFunc func(Envelope)
+
+// ApplyFunc replicates a command through this node's Raft group on
+// behalf of a peer that isn't the leader; see Cluster.apply.
+type ApplyFunc func(command) error
+
+// wireCodec lets BrokerService run over a plain grpc.Server/ClientConn
+// without a protoc-generated protobuf codec: every message below is a
+// plain Go struct (de)serialized as JSON, the same approach adminpb uses
+// for the admin API. It's registered under its own content-subtype
+// rather than reusing adminpb's "json" codec so this package has no
+// import-time dependency on adminpb.
+type wireCodec struct{}
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (wireCodec) Name() string {
+	return "hmqjson"
+}
+
+func init() {
+	encoding.RegisterCodec(wireCodec{})
+}
+
+// brokerServiceHandler is what backs BrokerService's hand-written
+// grpc.ServiceDesc below: Forward receives a stream of PUBLISHes
+// forwarded from a peer, and Apply lets a non-leader peer replicate a
+// command through this node's Raft group when this node is the leader.
+type brokerServiceHandler interface {
+	Forward(Envelope)
+	Apply(command) error
+}
+
+// brokerServiceServer is the concrete brokerServiceHandler registered
+// with serveForward.
+type brokerServiceServer struct {
+	handle  ForwardFunc
+	applyFn ApplyFunc
+}
+
+func (s *brokerServiceServer) Forward(env Envelope) { s.handle(env) }
+
+func (s *brokerServiceServer) Apply(cmd command) error { return s.applyFn(cmd) }
+
+// ackMsg is the terminal response sent once a Forward stream's sender
+// closes its send side.
+type ackMsg struct{}
+
+// applyResult is the response to a forwarded Apply RPC: Err is the
+// string form of whatever error raft.Apply returned, empty on success.
+type applyResult struct {
+	Err string `json:"err,omitempty"`
+}
+
+func handleForwardStream(srv interface{}, stream grpc.ServerStream) error {
+	s := srv.(brokerServiceHandler)
+	for {
+		var env Envelope
+		if err := stream.RecvMsg(&env); err != nil {
+			if err == io.EOF {
+				return stream.SendMsg(&ackMsg{})
+			}
+			return err
+		}
+		s.Forward(env)
+	}
+}
+
+func handleApply(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(command)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	s := srv.(brokerServiceHandler)
+	apply := func(ctx context.Context, req interface{}) (interface{}, error) {
+		cmd := req.(*command)
+		if err := s.Apply(*cmd); err != nil {
+			return &applyResult{Err: err.Error()}, nil
+		}
+		return &applyResult{}, nil
+	}
+	if interceptor == nil {
+		return apply(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/cluster.BrokerService/Apply"}
+	return interceptor(ctx, req, info, apply)
+}
+
+// brokerServiceDesc is BrokerService's grpc.ServiceDesc, hand-written in
+// the same style as adminpb.ServiceDesc since there's no protoc-gen-go
+// pipeline to generate it from a .proto file.
+var brokerServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cluster.BrokerService",
+	HandlerType: (*brokerServiceHandler)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Apply", Handler: handleApply},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Forward",
+			Handler:       handleForwardStream,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "cluster/broker.proto",
+}
+
+// forwardServer runs BrokerService on a grpc.Server, accepting forwarded
+// PUBLISHes and leader-apply requests from peer nodes.
+type forwardServer struct {
+	server *grpc.Server
+	lis    net.Listener
+}
+
+func serveForward(addr string, handle ForwardFunc, applyFn ApplyFunc) (*forwardServer, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := grpc.NewServer()
+	s.RegisterService(&brokerServiceDesc, &brokerServiceServer{handle: handle, applyFn: applyFn})
+	go s.Serve(lis)
+
+	return &forwardServer{server: s, lis: lis}, nil
+}
+
+func (s *forwardServer) close() error {
+	s.server.Stop()
+	return nil
+}
+
+// forwardClient is a long-lived BrokerService.Forward stream to a single
+// peer node, used to push every Envelope forwarded to it.
+type forwardClient struct {
+	cc     *grpc.ClientConn
+	mu     sync.Mutex
+	stream grpc.ClientStream
+}
+
+func dialForward(addr string) (*forwardClient, error) {
+	cc, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(wireCodec{}.Name())),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: dial forward %s: %w", addr, err)
+	}
+
+	stream, err := cc.NewStream(context.Background(), &brokerServiceDesc.Streams[0], "/cluster.BrokerService/Forward")
+	if err != nil {
+		cc.Close()
+		return nil, fmt.Errorf("cluster: open forward stream %s: %w", addr, err)
+	}
+
+	return &forwardClient{cc: cc, stream: stream}, nil
+}
+
+func (c *forwardClient) Forward(env Envelope) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stream.SendMsg(&env)
+}
+
+func (c *forwardClient) Close() error {
+	c.mu.Lock()
+	c.stream.CloseSend()
+	c.mu.Unlock()
+	return c.cc.Close()
+}
+
+// forwardApply sends cmd to the BrokerService.Apply RPC at addr, the
+// current Raft leader's forward address, and reports back the error it
+// applied with, if any. Unlike forwardClient, this dials a short-lived
+// connection per call since it's a one-shot unary RPC, not a stream
+// worth caching.
+func forwardApply(addr string, cmd command) error {
+	cc, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(wireCodec{}.Name())),
+	)
+	if err != nil {
+		return fmt.Errorf("cluster: dial leader %s: %w", addr, err)
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), raftTimeout)
+	defer cancel()
+
+	resp := new(applyResult)
+	if err := cc.Invoke(ctx, "/cluster.BrokerService/Apply", &cmd, resp); err != nil {
+		return err
+	}
+	if resp.Err != "" {
+		return errors.New(resp.Err)
+	}
+	return nil
+}
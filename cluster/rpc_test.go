@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForwardRoundTrip(t *testing.T) {
+	var mu sync.Mutex
+	var received []Envelope
+
+	srv, err := serveForward("127.0.0.1:0", func(env Envelope) {
+		mu.Lock()
+		received = append(received, env)
+		mu.Unlock()
+	}, func(command) error { return nil })
+	if err != nil {
+		t.Fatalf("serveForward: %v", err)
+	}
+	defer srv.close()
+
+	client, err := dialForward(srv.lis.Addr().String())
+	if err != nil {
+		t.Fatalf("dialForward: %v", err)
+	}
+	defer client.Close()
+
+	want := Envelope{OriginClientID: "c1", Topic: "a/b", Payload: []byte("hi"), Qos: 0}
+	if err := client.Forward(want); err != nil {
+		t.Fatalf("Forward: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for forwarded envelope")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	got := received[0]
+	mu.Unlock()
+	if got.OriginClientID != want.OriginClientID || got.Topic != want.Topic || string(got.Payload) != string(want.Payload) {
+		t.Fatalf("received %+v, want %+v", got, want)
+	}
+}
+
+func TestForwardApplySuccess(t *testing.T) {
+	var applied command
+	srv, err := serveForward("127.0.0.1:0", func(Envelope) {}, func(cmd command) error {
+		applied = cmd
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("serveForward: %v", err)
+	}
+	defer srv.close()
+
+	cmd := command{Kind: cmdAddClient, ClientID: "c1", Node: "node-a"}
+	if err := forwardApply(srv.lis.Addr().String(), cmd); err != nil {
+		t.Fatalf("forwardApply: %v", err)
+	}
+	if applied != cmd {
+		t.Fatalf("applyFn received %+v, want %+v", applied, cmd)
+	}
+}
+
+func TestForwardApplyPropagatesError(t *testing.T) {
+	srv, err := serveForward("127.0.0.1:0", func(Envelope) {}, func(command) error {
+		return errors.New("boom")
+	})
+	if err != nil {
+		t.Fatalf("serveForward: %v", err)
+	}
+	defer srv.close()
+
+	err = forwardApply(srv.lis.Addr().String(), command{Kind: cmdAddClient, ClientID: "c1"})
+	if err == nil || err.Error() != "boom" {
+		t.Fatalf("forwardApply error = %v, want boom", err)
+	}
+}
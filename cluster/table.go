@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"sync"
+
+	"github.com/fhmq/hmq/broker/topics"
+)
+
+// Table is the authoritative, Raft-replicated view of which node owns
+// which client-id and which node(s) have a subscriber filter matching a
+// given topic. Every node holds an identical copy, kept in sync by
+// applying the same sequence of commands through the FSM.
+//
+// Filter matching is delegated to broker/topics.Tree, the same
+// wildcard-aware trie the local broker uses for its own subscribers, so
+// a cluster-wide PUBLISH reaches a peer's "a/+/c" or "a/#" subscriber the
+// same way a local one would.
+type Table struct {
+	mu sync.RWMutex
+
+	// owners maps a client-id to the node currently holding that session.
+	owners map[string]string
+
+	// tree indexes every subscribed filter across the cluster; Subscribe
+	// is keyed by client-id the same way the local broker's tree is, and
+	// owners is used to translate a matched client-id back to its node.
+	tree *topics.Tree
+}
+
+func newTable() *Table {
+	return &Table{
+		owners: make(map[string]string),
+		tree:   topics.New(),
+	}
+}
+
+func (t *Table) addClient(clientID, node string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.owners[clientID] = node
+}
+
+func (t *Table) deleteClient(clientID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.owners, clientID)
+	t.tree.UnsubscribeAll(clientID)
+}
+
+// Owner reports which node currently holds the session for clientID.
+func (t *Table) Owner(clientID string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node, found := t.owners[clientID]
+	return node, found
+}
+
+func (t *Table) subscribe(clientID, node, filter string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// A subscribe command always carries the owning node, but it may
+	// arrive before the matching addClient command has (commands from
+	// different nodes interleave in the Raft log); record it here too so
+	// Subscribers never loses a node mapping to ordering.
+	if _, ok := t.owners[clientID]; !ok {
+		t.owners[clientID] = node
+	}
+	t.tree.Subscribe(clientID, filter, 0)
+}
+
+func (t *Table) unsubscribe(clientID, filter string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tree.Unsubscribe(clientID, filter)
+}
+
+// Subscribers returns the node for every subscriber whose filter matches
+// topic, on a node other than excludeNode, deduplicated.
+func (t *Table) Subscribers(topic, excludeNode string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var nodes []string
+	for _, sub := range t.tree.Match(topic) {
+		node, ok := t.owners[sub.ClientID]
+		if !ok || node == excludeNode || seen[node] {
+			continue
+		}
+		seen[node] = true
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
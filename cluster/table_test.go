@@ -0,0 +1,68 @@
+package cluster
+
+import "testing"
+
+func TestTableSubscribersMatchesWildcards(t *testing.T) {
+	tbl := newTable()
+	tbl.addClient("c1", "node-a")
+	tbl.addClient("c2", "node-b")
+	tbl.subscribe("c1", "node-a", "a/+/c")
+	tbl.subscribe("c2", "node-b", "a/#")
+
+	got := tbl.Subscribers("a/b/c", "")
+	want := map[string]bool{"node-a": true, "node-b": true}
+	if len(got) != len(want) {
+		t.Fatalf("Subscribers(a/b/c) = %v, want nodes %v", got, want)
+	}
+	for _, node := range got {
+		if !want[node] {
+			t.Errorf("Subscribers(a/b/c) returned unexpected node %q", node)
+		}
+	}
+}
+
+func TestTableSubscribersExcludesNode(t *testing.T) {
+	tbl := newTable()
+	tbl.addClient("c1", "node-a")
+	tbl.subscribe("c1", "node-a", "a/b")
+
+	if got := tbl.Subscribers("a/b", "node-a"); len(got) != 0 {
+		t.Fatalf("Subscribers with excludeNode = %v, want none", got)
+	}
+}
+
+func TestTableSubscribeBeforeAddClient(t *testing.T) {
+	// The Raft log can interleave commands from different nodes, so a
+	// subscribe command may be applied before its matching addClient one.
+	tbl := newTable()
+	tbl.subscribe("c1", "node-a", "a/b")
+
+	if node, ok := tbl.Owner("c1"); !ok || node != "node-a" {
+		t.Fatalf("Owner(c1) = (%q, %v), want (node-a, true)", node, ok)
+	}
+}
+
+func TestTableDeleteClientRemovesSubscriptions(t *testing.T) {
+	tbl := newTable()
+	tbl.addClient("c1", "node-a")
+	tbl.subscribe("c1", "node-a", "a/b")
+	tbl.deleteClient("c1")
+
+	if got := tbl.Subscribers("a/b", ""); len(got) != 0 {
+		t.Fatalf("Subscribers after deleteClient = %v, want none", got)
+	}
+	if _, ok := tbl.Owner("c1"); ok {
+		t.Fatal("Owner(c1) found after deleteClient")
+	}
+}
+
+func TestTableUnsubscribe(t *testing.T) {
+	tbl := newTable()
+	tbl.addClient("c1", "node-a")
+	tbl.subscribe("c1", "node-a", "a/b")
+	tbl.unsubscribe("c1", "a/b")
+
+	if got := tbl.Subscribers("a/b", ""); len(got) != 0 {
+		t.Fatalf("Subscribers after unsubscribe = %v, want none", got)
+	}
+}
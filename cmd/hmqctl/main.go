@@ -0,0 +1,153 @@
+// Command hmqctl is a small operational CLI for hmq's AdminService gRPC
+// API: listing/inspecting/disconnecting clients, publishing a message, and
+// reading broker stats, without going through MQTT.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fhmq/hmq/adminpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9090", "AdminService gRPC address")
+	token := flag.String("token", "", "bearer token, if the broker requires one")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: hmqctl [-addr host:port] [-token t] <list-clients|get-client|disconnect|publish|list-subs|stats> [args...]")
+		os.Exit(2)
+	}
+
+	cc, err := grpc.Dial(*addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype("json")),
+	)
+	if err != nil {
+		fatal(err)
+	}
+	defer cc.Close()
+
+	client := adminpb.NewAdminServiceClient(cc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if *token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+*token)
+	}
+
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "list-clients":
+		runListClients(ctx, client)
+	case "get-client":
+		runGetClient(ctx, client, rest)
+	case "disconnect":
+		runDisconnect(ctx, client, rest)
+	case "publish":
+		runPublish(ctx, client, rest)
+	case "list-subs":
+		runListSubscriptions(ctx, client)
+	case "stats":
+		runStats(ctx, client)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		os.Exit(2)
+	}
+}
+
+func runListClients(ctx context.Context, client adminpb.AdminServiceClient) {
+	stream, err := client.ListClients(ctx, &adminpb.ListClientsRequest{})
+	if err != nil {
+		fatal(err)
+	}
+	for {
+		c, err := stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("%s\t%s\tpublishOnly=%v\n", c.ClientID, c.RemoteAddr, c.PublishOnly)
+	}
+}
+
+func runGetClient(ctx context.Context, client adminpb.AdminServiceClient, args []string) {
+	if len(args) != 1 {
+		fatal(fmt.Errorf("usage: hmqctl get-client <clientID>"))
+	}
+	resp, err := client.GetClient(ctx, &adminpb.GetClientRequest{ClientID: args[0]})
+	if err != nil {
+		fatal(err)
+	}
+	if !resp.Found {
+		fmt.Println("not found")
+		return
+	}
+	fmt.Printf("%s\t%s\tpublishOnly=%v\n", resp.Client.ClientID, resp.Client.RemoteAddr, resp.Client.PublishOnly)
+}
+
+func runDisconnect(ctx context.Context, client adminpb.AdminServiceClient, args []string) {
+	if len(args) != 1 {
+		fatal(fmt.Errorf("usage: hmqctl disconnect <clientID>"))
+	}
+	resp, err := client.DisconnectClient(ctx, &adminpb.DisconnectClientRequest{ClientID: args[0]})
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("disconnected=%v\n", resp.Disconnected)
+}
+
+func runPublish(ctx context.Context, client adminpb.AdminServiceClient, args []string) {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	qos := fs.Int("qos", 0, "QoS")
+	retain := fs.Bool("retain", false, "retain flag")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fatal(fmt.Errorf("usage: hmqctl publish [-qos n] [-retain] <topic> <payload>"))
+	}
+
+	_, err := client.PublishMessage(ctx, &adminpb.PublishMessageRequest{
+		Topic:   fs.Arg(0),
+		Payload: []byte(fs.Arg(1)),
+		Qos:     byte(*qos),
+		Retain:  *retain,
+	})
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func runListSubscriptions(ctx context.Context, client adminpb.AdminServiceClient) {
+	resp, err := client.ListSubscriptions(ctx, &adminpb.ListSubscriptionsRequest{})
+	if err != nil {
+		fatal(err)
+	}
+	for _, s := range resp.Subscriptions {
+		fmt.Printf("%s\t%s\tqos=%d\n", s.ClientID, s.Filter, s.Qos)
+	}
+}
+
+func runStats(ctx context.Context, client adminpb.AdminServiceClient) {
+	resp, err := client.Stats(ctx, &adminpb.StatsRequest{})
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("uptime=%ds clients=%d in=%d out=%d workerPoolDepth=%d\n",
+		resp.UptimeSeconds, resp.ConnectedClients, resp.MessagesIn, resp.MessagesOut, resp.WorkerPoolDepth)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "hmqctl:", err)
+	os.Exit(1)
+}